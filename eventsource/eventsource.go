@@ -17,9 +17,12 @@ type EventSource[T any] struct {
 	value atomic.Value
 }
 
-func New[T any]() *EventSource[T] {
+// New creates a new EventSource with the zero value of T.
+//
+// Options are passed through to the underlying pubsub.Topic.
+func New[T any](options ...pubsub.Option) *EventSource[T] {
 	var t T
-	e := &EventSource[T]{Topic: pubsub.New[T]()}
+	e := &EventSource[T]{Topic: pubsub.New[T](options...)}
 	e.value.Store(t)
 	changes := make(chan pubsub.Message[T], 64)
 	e.SubscribeSync(changes)
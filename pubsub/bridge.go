@@ -0,0 +1,355 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"sync"
+	"time"
+)
+
+// BridgeHeader is set on messages published to a Topic by a Bridge, to the ID
+// of the Bridge.
+//
+// A Bridge does not forward messages it published itself, so that messages
+// are not echoed back to the peer.
+const BridgeHeader = "Pubsub-Bridge"
+
+// ErrBridgeTimeout is returned to synchronous publishers if the peer of a
+// Bridge does not reply in time.
+var ErrBridgeTimeout = errors.New("bridge: timed out waiting for peer")
+
+// Bridge connects a Topic to a Topic in another process.
+//
+// Messages published to either topic are published to the other, along with
+// their ID, publish time, headers and priority. If a message was published with
+// PublishSync, the bridge waits for the peer to deliver it and returns any
+// error from the peer's subscribers to the publisher. If the peer does not
+// reply within half the local topic's ack timeout, the message is nacked with
+// ErrBridgeTimeout.
+//
+// Messages published without waiting are forwarded without waiting for the
+// peer, so that publishing in both directions at once does not deadlock.
+// Synchronous publishes from both sides at once do deadlock, as each topic is
+// blocked waiting for the other, until both fail with ErrBridgeTimeout. Use
+// PublishSync in one direction only.
+//
+// Bridges should be connected in a tree, as messages are forwarded to every
+// other bridge on a topic.
+type Bridge[T any] struct {
+	id    string
+	topic *Topic[T]
+	conn  io.ReadWriteCloser
+	codec Codec[T]
+	sub   chan Message[T]
+	// Replies awaited by the forwarder, by sequence number.
+	pendingLock sync.Mutex
+	pending     map[uint64]chan bridgeFrame
+	// Serialises writes to conn.
+	lock sync.Mutex
+	enc  *json.Encoder
+	// Cancelled when the Bridge starts closing.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	// Closed when the Bridge is closed.
+	done chan struct{}
+	err  error
+}
+
+type bridgeFrameType string
+
+const (
+	bridgeFramePublish bridgeFrameType = "publish"
+	bridgeFrameAck     bridgeFrameType = "ack"
+)
+
+// A message sent between peers.
+type bridgeFrame struct {
+	Type bridgeFrameType `json:"type"`
+	Seq  uint64          `json:"seq"`
+	// Set for publish frames.
+	ID       string            `json:"id,omitempty"`
+	Time     time.Time         `json:"time"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Priority Priority          `json:"priority,omitempty"`
+	Payload  []byte            `json:"payload,omitempty"`
+	// If true the peer replies with an ack frame.
+	Reply bool `json:"reply,omitempty"`
+	// Set for ack frames if the message was nacked.
+	Error string `json:"error,omitempty"`
+}
+
+// NewBridge connects topic to a peer over conn, encoding messages with codec.
+//
+// The peer must also be a Bridge. The Bridge takes ownership of conn, closing
+// it when the Bridge is closed. If the connection fails or the topic is
+// closed, the Bridge is closed.
+func NewBridge[T any](topic *Topic[T], conn io.ReadWriteCloser, codec Codec[T]) *Bridge[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Bridge[T]{
+		id:      newMessageID(),
+		topic:   topic,
+		conn:    conn,
+		codec:   codec,
+		pending: map[uint64]chan bridgeFrame{},
+		enc:     json.NewEncoder(conn),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	sub, err := topic.subscribeSync(ctx, nil, nil, nil, getSubscriber())
+	if err != nil {
+		b.stop(err)
+		close(b.done)
+		return b
+	}
+	b.sub = sub
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		b.forward()
+	}()
+	go func() {
+		defer wg.Done()
+		b.receive()
+	}()
+	go func() {
+		wg.Wait()
+		close(b.done)
+	}()
+	return b
+}
+
+// Wait returns a channel that will be closed when the Bridge is closed.
+func (b *Bridge[T]) Wait() chan struct{} {
+	return b.done
+}
+
+// Err returns the error that closed the Bridge, if any, once it is closed.
+func (b *Bridge[T]) Err() error {
+	select {
+	case <-b.done:
+		return b.err
+	default:
+		return nil
+	}
+}
+
+// Close the Bridge and its connection, blocking until it is closed.
+//
+// The topic is not closed.
+func (b *Bridge[T]) Close() error {
+	b.stop(nil)
+	<-b.done
+	return nil
+}
+
+// Start closing the Bridge, recording the first error.
+func (b *Bridge[T]) stop(err error) {
+	b.closeOnce.Do(func() {
+		b.err = err
+		b.cancel()
+		_ = b.conn.Close()
+		if b.sub == nil {
+			// The topic was closed before we subscribed.
+			return
+		}
+		// Nack anything in flight so the topic is not blocked while we
+		// unsubscribe.
+		go func() {
+			for msg := range b.sub {
+				msg.Nack(ErrClosed)
+			}
+		}()
+		_ = b.topic.UnsubscribeSyncContext(context.Background(), b.sub)
+	})
+}
+
+// Forward messages published to the local topic to the peer.
+func (b *Bridge[T]) forward() {
+	seq := uint64(0)
+	for {
+		var msg Message[T]
+		select {
+		case m, ok := <-b.sub:
+			if !ok {
+				// The topic was closed.
+				b.stop(nil)
+				return
+			}
+			msg = m
+		case <-b.ctx.Done():
+			return
+		}
+		if msg.Headers[BridgeHeader] == b.id {
+			msg.Ack()
+			continue
+		}
+		payload, err := b.codec.Encode(msg.Msg)
+		if err != nil {
+			msg.Nack(fmt.Errorf("bridge: failed to encode message: %w", err))
+			continue
+		}
+		seq++
+		var reply chan bridgeFrame
+		if msg.sync {
+			reply = b.expectReply(seq)
+		}
+		err = b.write(bridgeFrame{
+			Type:     bridgeFramePublish,
+			Seq:      seq,
+			ID:       msg.ID,
+			Time:     msg.Time,
+			Headers:  msg.Headers,
+			Priority: msg.priority,
+			Payload:  payload,
+			Reply:    msg.sync,
+		})
+		if err != nil {
+			msg.Nack(err)
+			b.stop(err)
+			return
+		}
+		if !msg.sync {
+			msg.Ack()
+			continue
+		}
+		if err := b.awaitReply(seq, reply); err != nil {
+			msg.Nack(err)
+		} else {
+			msg.Ack()
+		}
+	}
+}
+
+// Register a reply to the publish frame "seq" as awaited.
+func (b *Bridge[T]) expectReply(seq uint64) chan bridgeFrame {
+	reply := make(chan bridgeFrame, 1)
+	b.pendingLock.Lock()
+	defer b.pendingLock.Unlock()
+	b.pending[seq] = reply
+	return reply
+}
+
+// Wait for the peer to ack the publish frame "seq".
+//
+// The wait is bounded below the topic's ack timeout, so that an unresponsive
+// peer fails the publish rather than triggering the slow subscriber policy.
+func (b *Bridge[T]) awaitReply(seq uint64, reply chan bridgeFrame) error {
+	defer func() {
+		b.pendingLock.Lock()
+		delete(b.pending, seq)
+		b.pendingLock.Unlock()
+	}()
+	timer := b.topic.options.clock.NewTimer(b.topic.options.ackTimeout / 2)
+	defer timer.Stop()
+	select {
+	case frame := <-reply:
+		if frame.Error != "" {
+			return errors.New(frame.Error)
+		}
+		return nil
+	case <-timer.C():
+		return ErrBridgeTimeout
+	case <-b.ctx.Done():
+		return ErrClosed
+	}
+}
+
+// Pass an ack frame to the forwarder waiting for it, discarding late replies
+// to publishes that have already timed out.
+func (b *Bridge[T]) replied(frame bridgeFrame) {
+	b.pendingLock.Lock()
+	defer b.pendingLock.Unlock()
+	if reply, ok := b.pending[frame.Seq]; ok {
+		delete(b.pending, frame.Seq)
+		reply <- frame
+	}
+}
+
+// Receive frames from the peer.
+func (b *Bridge[T]) receive() {
+	dec := json.NewDecoder(b.conn)
+	for {
+		var frame bridgeFrame
+		if err := dec.Decode(&frame); err != nil {
+			select {
+			case <-b.ctx.Done():
+				// The connection was closed by Close.
+				b.stop(nil)
+			default:
+				if errors.Is(err, io.EOF) {
+					b.stop(nil)
+				} else {
+					b.stop(fmt.Errorf("bridge: failed to read from peer: %w", err))
+				}
+			}
+			return
+		}
+		switch frame.Type {
+		case bridgeFramePublish:
+			b.publish(frame)
+
+		case bridgeFrameAck:
+			b.replied(frame)
+
+		default:
+			b.stop(fmt.Errorf("bridge: unknown frame type %q", frame.Type))
+			return
+		}
+	}
+}
+
+// Publish a message received from the peer to the local topic, replying with
+// the result if the peer is waiting for it.
+func (b *Bridge[T]) publish(frame bridgeFrame) {
+	reply := func(err error) {
+		if !frame.Reply {
+			return
+		}
+		ack := bridgeFrame{Type: bridgeFrameAck, Seq: frame.Seq}
+		if err != nil {
+			ack.Error = err.Error()
+		}
+		if err := b.write(ack); err != nil {
+			b.stop(err)
+		}
+	}
+	t, err := b.codec.Decode(frame.Payload)
+	if err != nil {
+		reply(fmt.Errorf("bridge: failed to decode message: %w", err))
+		return
+	}
+	headers := maps.Clone(frame.Headers)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headers[BridgeHeader] = b.id
+	msg := b.topic.newMessage(t, []PublishOption{WithMessageID(frame.ID), WithHeaders(headers), WithPriority(frame.Priority)})
+	if !frame.Time.IsZero() {
+		msg.Time = frame.Time
+	}
+	// Queue the message without waiting for it to be delivered, so that
+	// frames continue to be received.
+	if err := b.topic.enqueue(b.ctx, msg, nil); err != nil {
+		reply(err)
+		return
+	}
+	if frame.Reply {
+		go func() { reply(<-msg.ack) }()
+	}
+}
+
+func (b *Bridge[T]) write(frame bridgeFrame) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := b.enc.Encode(frame); err != nil {
+		return fmt.Errorf("bridge: failed to write to peer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	. "github.com/alecthomas/types/pubsub" //nolint
+)
+
+func bridged(t *testing.T) (local, remote *Topic[string]) {
+	t.Helper()
+	local = New[string]()
+	remote = New[string]()
+	a, b := net.Pipe()
+	localBridge := NewBridge(local, a, JSONCodec[string]{})
+	remoteBridge := NewBridge(remote, b, JSONCodec[string]{})
+	t.Cleanup(func() {
+		assert.NoError(t, localBridge.Close())
+		assert.NoError(t, remoteBridge.Close())
+		_ = local.Close()
+		_ = remote.Close()
+	})
+	return local, remote
+}
+
+func TestBridge(t *testing.T) {
+	local, remote := bridged(t)
+	localCh := local.SubscribeSync(nil)
+	remoteCh := remote.SubscribeSync(nil)
+
+	go func() {
+		msg := <-remoteCh
+		msg.Ack()
+		msg = <-remoteCh
+		msg.Nack(errors.New("remote nack"))
+	}()
+	go func() {
+		for range 2 {
+			msg := <-localCh
+			msg.Ack()
+		}
+	}()
+	assert.NoError(t, local.PublishSync("hello", WithMessageID("id"), WithHeader("trace", "abc")))
+	assert.EqualError(t, local.PublishSync("world"), "remote nack")
+}
+
+func TestBridgeMetadata(t *testing.T) {
+	local, remote := bridged(t)
+	remoteCh := remote.SubscribeSync(nil)
+	local.Publish("hello", WithMessageID("id"), WithHeader("trace", "abc"))
+	msg := <-remoteCh
+	msg.Ack()
+	assert.Equal(t, "hello", msg.Msg)
+	assert.Equal(t, "id", msg.ID)
+	assert.Equal(t, "abc", msg.Headers["trace"])
+	assert.NotEqual(t, "", msg.Headers[BridgeHeader])
+}
+
+func TestBridgeBothDirections(t *testing.T) {
+	local, remote := bridged(t)
+	localCh := local.Subscribe(make(chan string, 100))
+	remoteCh := remote.Subscribe(make(chan string, 100))
+	for range 50 {
+		local.Publish("local")
+		remote.Publish("remote")
+	}
+	// Each side receives its own messages and the peer's, and messages are
+	// not echoed back.
+	for _, ch := range []chan string{localCh, remoteCh} {
+		counts := map[string]int{}
+		for range 100 {
+			select {
+			case msg := <-ch:
+				counts[msg]++
+			case <-time.After(time.Second * 5):
+				t.Fatal("timeout")
+			}
+		}
+		assert.Equal(t, map[string]int{"local": 50, "remote": 50}, counts)
+		select {
+		case msg := <-ch:
+			t.Fatalf("unexpected message %q", msg)
+		case <-time.After(time.Millisecond * 50):
+		}
+	}
+}
+
+func TestBridgeClosedByPeer(t *testing.T) {
+	local := New[string]()
+	defer local.Close() //nolint
+	a, b := net.Pipe()
+	bridge := NewBridge(local, a, JSONCodec[string]{})
+	assert.NoError(t, b.Close())
+	select {
+	case <-bridge.Wait():
+	case <-time.After(time.Second):
+		t.Fatal("bridge should have closed")
+	}
+	assert.NoError(t, bridge.Err())
+	// The topic is still usable.
+	assert.NoError(t, local.PublishSyncContext(context.Background(), "hello"))
+}
+
+func TestBridgeClosedTopic(t *testing.T) {
+	local := New[string]()
+	assert.NoError(t, local.Close())
+	a, b := net.Pipe()
+	defer b.Close() //nolint
+	bridge := NewBridge(local, a, JSONCodec[string]{})
+	assert.IsError(t, bridge.Err(), ErrClosed)
+	assert.NoError(t, bridge.Close())
+	assert.IsError(t, bridge.Err(), ErrClosed)
+}
+
+func TestBridgeReplyTimeout(t *testing.T) {
+	local := New[string](WithAckTimeout(time.Millisecond * 200))
+	defer local.Close() //nolint
+	a, b := net.Pipe()
+	bridge := NewBridge(local, a, JSONCodec[string]{})
+	defer bridge.Close() //nolint
+	// A peer that never replies.
+	go func() { _, _ = io.Copy(io.Discard, b) }()
+	assert.IsError(t, local.PublishSync("hello"), ErrBridgeTimeout)
+}
+
+func TestBridgeLateReply(t *testing.T) {
+	local := New[string](WithAckTimeout(time.Millisecond * 200))
+	defer local.Close() //nolint
+	remote := New[string]()
+	defer remote.Close() //nolint
+	a, b := net.Pipe()
+	localBridge := NewBridge(local, a, JSONCodec[string]{})
+	defer localBridge.Close() //nolint
+	remoteBridge := NewBridge(remote, b, JSONCodec[string]{})
+	defer remoteBridge.Close() //nolint
+	remoteCh := remote.SubscribeSync(nil)
+
+	result := make(chan error, 1)
+	go func() { result <- local.PublishSync("slow") }()
+	msg := <-remoteCh
+	assert.IsError(t, <-result, ErrBridgeTimeout)
+	localCh := local.Subscribe(nil)
+	// The late reply must not block frames from the peer.
+	msg.Ack()
+	time.Sleep(time.Millisecond * 10)
+	go func() {
+		msg := <-remoteCh
+		msg.Ack()
+	}()
+	remote.Publish("after")
+	select {
+	case msg := <-localCh:
+		assert.Equal(t, "after", msg)
+	case <-time.After(time.Second * 2):
+		t.Fatal("message from peer was not received")
+	}
+}
@@ -0,0 +1,46 @@
+package pubsub
+
+import "time"
+
+// Clock is the source of time for a Topic, used for ack and publish timeouts,
+// redelivery backoff, message times and history expiry.
+//
+// It can be replaced with WithClock so that tests can control time, see
+// pubsubtest.Clock.
+type Clock interface {
+	Now() time.Time
+	// NewTimer creates a Timer that fires once after d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single-shot timer created by a Clock, equivalent to time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	// Stop the Timer, returning false if it had already fired or been
+	// stopped.
+	Stop() bool
+	// Reset the Timer to fire after d, returning false if it had already
+	// fired or been stopped.
+	Reset(d time.Duration) bool
+}
+
+// The Clock used by default, backed by package time.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+// Block for d according to clock.
+func sleep(clock Clock, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	<-timer.C()
+}
@@ -0,0 +1,22 @@
+package pubsub
+
+import "encoding/json"
+
+// Codec encodes and decodes messages for storage or transport.
+type Codec[T any] interface {
+	Encode(msg T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec is a Codec that uses encoding/json.
+type JSONCodec[T any] struct{}
+
+var _ Codec[int] = JSONCodec[int]{}
+
+func (JSONCodec[T]) Encode(msg T) ([]byte, error) { return json.Marshal(msg) }
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var msg T
+	err := json.Unmarshal(data, &msg)
+	return msg, err
+}
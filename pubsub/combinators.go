@@ -0,0 +1,239 @@
+package pubsub
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Merge returns a new Topic that receives every message published to any of
+// topics.
+//
+// As with Map, the returned Topic is synchronously subscribed to each topic
+// and errors are propagated. Messages keep their ID and headers.
+//
+// The returned Topic is closed once all topics are closed, and closing it
+// unsubscribes it from all topics. Options are applied to the returned Topic.
+func Merge[T any](topics []*Topic[T], options ...Option) *Topic[T] {
+	out := New[T](options...)
+	subscriber := getSubscriber()
+	if len(topics) == 0 {
+		_ = out.Close()
+		return out
+	}
+	remaining := atomic.Int64{}
+	remaining.Store(int64(len(topics)))
+	for _, topic := range topics {
+		relay(topic, out, subscriber, func(msg Message[T]) error {
+			return out.PublishSync(msg.Msg, WithMessageID(msg.ID), WithHeaders(msg.Headers))
+		}, func() {
+			if remaining.Add(-1) == 0 {
+				_ = out.Close()
+			}
+		})
+	}
+	return out
+}
+
+// Tee returns "n" new Topics that each receive every message published to
+// topic, so that they can be consumed and closed independently.
+//
+// As with Map, each returned Topic is synchronously subscribed to topic and
+// errors are propagated. Messages keep their ID and headers.
+//
+// The returned Topics are closed when topic is closed. Options are applied to
+// each returned Topic.
+func Tee[T any](topic *Topic[T], n int, options ...Option) []*Topic[T] {
+	subscriber := getSubscriber()
+	outs := make([]*Topic[T], n)
+	for i := range outs {
+		out := New[T](options...)
+		relay(topic, out, subscriber, func(msg Message[T]) error {
+			return out.PublishSync(msg.Msg, WithMessageID(msg.ID), WithHeaders(msg.Headers))
+		}, func() { _ = out.Close() })
+		outs[i] = out
+	}
+	return outs
+}
+
+// Batch returns a new Topic that receives messages published to topic in
+// batches of up to "size" messages.
+//
+// A batch is published once it is full, or "maxWait" after its first message
+// was received if maxWait is non-zero. Messages are acked as they are added to
+// a batch, so errors from subscribers of the returned Topic are not propagated.
+//
+// When topic is closed any partial batch is published and the returned Topic
+// is shut down. Closing the returned Topic unsubscribes it from topic. Options
+// are applied to the returned Topic.
+func Batch[T any](topic *Topic[T], size int, maxWait time.Duration, options ...Option) *Topic[[]T] {
+	out := New[[]T](options...)
+	in, err := topic.subscribeSync(context.Background(), nil, nil, nil, getSubscriber())
+	if err != nil {
+		_ = out.Close()
+		return out
+	}
+	go func() {
+		batch := []T{}
+		timer := newStoppedTimer(out.options.clock)
+		defer timer.Stop()
+		flush := func() {
+			timer.Stop()
+			if len(batch) > 0 {
+				_ = out.PublishContext(context.Background(), batch)
+				batch = []T{}
+			}
+		}
+		for {
+			select {
+			case msg, ok := <-in:
+				if !ok {
+					flush()
+					_ = out.Shutdown(context.Background())
+					return
+				}
+				msg.Ack()
+				batch = append(batch, msg.Msg)
+				if len(batch) == 1 && maxWait > 0 {
+					timer.Reset(maxWait)
+				}
+				if len(batch) >= size {
+					flush()
+				}
+
+			case <-timer.C():
+				flush()
+
+			case <-out.Wait():
+				unsubscribeDraining(topic, in)
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Debounce returns a new Topic that receives the last message published to
+// topic once no messages have been published for "d".
+//
+// Messages are acked as they are received, so errors from subscribers of the
+// returned Topic are not propagated. The published message keeps its ID and
+// headers.
+//
+// When topic is closed any pending message is published and the returned
+// Topic is shut down. Closing the returned Topic unsubscribes it from topic.
+// Options are applied to the returned Topic.
+func Debounce[T any](topic *Topic[T], d time.Duration, options ...Option) *Topic[T] {
+	out := New[T](options...)
+	in, err := topic.subscribeSync(context.Background(), nil, nil, nil, getSubscriber())
+	if err != nil {
+		_ = out.Close()
+		return out
+	}
+	go func() {
+		var pending *Message[T]
+		timer := newStoppedTimer(out.options.clock)
+		defer timer.Stop()
+		flush := func() {
+			if pending != nil {
+				republish(out, *pending)
+				pending = nil
+			}
+		}
+		for {
+			select {
+			case msg, ok := <-in:
+				if !ok {
+					flush()
+					_ = out.Shutdown(context.Background())
+					return
+				}
+				msg.Ack()
+				pending = &msg
+				timer.Reset(d)
+
+			case <-timer.C():
+				flush()
+
+			case <-out.Wait():
+				unsubscribeDraining(topic, in)
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Throttle returns a new Topic that receives at most one message every
+// "interval" from topic.
+//
+// The first message is published immediately. Messages received during the
+// following interval are discarded, except for the last, which is published
+// at the end of the interval.
+//
+// Messages are acked as they are received, so errors from subscribers of the
+// returned Topic are not propagated. Published messages keep their ID and
+// headers.
+//
+// When topic is closed any pending message is published and the returned
+// Topic is shut down. Closing the returned Topic unsubscribes it from topic.
+// Options are applied to the returned Topic.
+func Throttle[T any](topic *Topic[T], interval time.Duration, options ...Option) *Topic[T] {
+	out := New[T](options...)
+	in, err := topic.subscribeSync(context.Background(), nil, nil, nil, getSubscriber())
+	if err != nil {
+		_ = out.Close()
+		return out
+	}
+	go func() {
+		var pending *Message[T]
+		throttled := false
+		timer := newStoppedTimer(out.options.clock)
+		defer timer.Stop()
+		for {
+			select {
+			case msg, ok := <-in:
+				if !ok {
+					if pending != nil {
+						republish(out, *pending)
+					}
+					_ = out.Shutdown(context.Background())
+					return
+				}
+				msg.Ack()
+				if throttled {
+					pending = &msg
+					break
+				}
+				republish(out, msg)
+				throttled = true
+				timer.Reset(interval)
+
+			case <-timer.C():
+				if pending == nil {
+					throttled = false
+					break
+				}
+				republish(out, *pending)
+				pending = nil
+				timer.Reset(interval)
+
+			case <-out.Wait():
+				unsubscribeDraining(topic, in)
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Publish a message from a source topic to out, keeping its ID and headers.
+func republish[T any](out *Topic[T], msg Message[T]) {
+	_ = out.PublishContext(context.Background(), msg.Msg, WithMessageID(msg.ID), WithHeaders(msg.Headers))
+}
+
+func newStoppedTimer(clock Clock) Timer {
+	timer := clock.NewTimer(time.Hour)
+	timer.Stop()
+	return timer
+}
@@ -0,0 +1,137 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	. "github.com/alecthomas/types/pubsub" //nolint
+)
+
+func receive[T any](t *testing.T, ch chan T) T {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout")
+		panic("unreachable")
+	}
+}
+
+func assertClosed[T any](t *testing.T, topic *Topic[T]) {
+	t.Helper()
+	select {
+	case <-topic.Wait():
+	case <-time.After(time.Second * 5):
+		t.Fatal("topic should have been closed")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := New[string]()
+	b := New[string]()
+	merged := Merge([]*Topic[string]{a, b}, WithHistory(1))
+	ch := merged.SubscribeSync(nil)
+	go func() {
+		msg := <-ch
+		msg.Ack()
+		msg = <-ch
+		msg.Nack(errors.New("nack " + msg.Msg))
+	}()
+	assert.NoError(t, a.PublishSync("a"))
+	assert.EqualError(t, b.PublishSync("b"), "nack b")
+	// Options are applied to the merged topic.
+	assert.Equal(t, "b", <-merged.Subscribe(nil))
+
+	_ = a.Close()
+	select {
+	case <-merged.Wait():
+		t.Fatal("merged topic should be open until all sources are closed")
+	default:
+	}
+	_ = b.Close()
+	assertClosed(t, merged)
+}
+
+func TestTee(t *testing.T) {
+	topic := New[string]()
+	outs := Tee(topic, 2)
+	first := outs[0].Subscribe(nil)
+	second := outs[1].Subscribe(nil)
+	assert.NoError(t, topic.PublishSync("hello", WithMessageID("id")))
+	assert.Equal(t, "hello", receive(t, first))
+	assert.Equal(t, "hello", receive(t, second))
+
+	// Closing one output does not affect the other.
+	_ = outs[0].Close()
+	assert.NoError(t, topic.PublishSync("world"))
+	assert.Equal(t, "world", receive(t, second))
+	_ = topic.Close()
+	assertClosed(t, outs[1])
+}
+
+func TestBatch(t *testing.T) {
+	topic := New[int]()
+	batches := Batch(topic, 3, time.Millisecond*50)
+	ch := batches.Subscribe(nil)
+	for i := range 4 {
+		topic.Publish(i)
+	}
+	assert.Equal(t, []int{0, 1, 2}, receive(t, ch))
+	// The partial batch is published after maxWait.
+	assert.Equal(t, []int{3}, receive(t, ch))
+
+	topic.Publish(4)
+	assert.NoError(t, topic.Shutdown(context.Background()))
+	// And when the source closes.
+	assert.Equal(t, []int{4}, receive(t, ch))
+	assertClosed(t, batches)
+}
+
+func TestDebounce(t *testing.T) {
+	topic := New[int]()
+	debounced := Debounce(topic, time.Millisecond*50)
+	ch := debounced.Subscribe(nil)
+	for i := range 3 {
+		topic.Publish(i)
+	}
+	assert.Equal(t, 2, receive(t, ch))
+	topic.Publish(3)
+	assert.Equal(t, 3, receive(t, ch))
+	_ = topic.Close()
+	assertClosed(t, debounced)
+}
+
+func TestThrottle(t *testing.T) {
+	topic := New[int]()
+	throttled := Throttle(topic, time.Millisecond*100)
+	ch := throttled.Subscribe(nil)
+	for i := range 3 {
+		assert.NoError(t, topic.PublishSync(i))
+	}
+	// The first message is published immediately, and the last at the end of
+	// the interval.
+	assert.Equal(t, 0, receive(t, ch))
+	assert.Equal(t, 2, receive(t, ch))
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected message %d", msg)
+	case <-time.After(time.Millisecond * 150):
+	}
+	_ = topic.Close()
+	assertClosed(t, throttled)
+}
+
+func TestCombinatorCloseDerived(t *testing.T) {
+	topic := New[int]()
+	defer topic.Close() //nolint
+	batches := Batch(topic, 10, 0)
+	_ = batches.Close()
+	// The source is not blocked by the closed derived topic.
+	for i := range 100 {
+		assert.NoError(t, topic.PublishSync(i))
+	}
+}
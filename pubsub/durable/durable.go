@@ -0,0 +1,401 @@
+// Package durable provides a pubsub.Topic whose messages are persisted to a
+// SQLite log, allowing subscribers to resume from an offset or timestamp
+// after a restart.
+//
+// The caller is responsible for opening the database and registering a SQLite
+// driver, such as modernc.org/sqlite.
+package durable
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/types/pubsub"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS pubsub_log (
+	topic TEXT NOT NULL,
+	seq INTEGER NOT NULL,
+	published_at INTEGER NOT NULL,
+	payload BLOB NOT NULL,
+	PRIMARY KEY (topic, seq)
+);
+CREATE INDEX IF NOT EXISTS pubsub_log_published_at ON pubsub_log (topic, published_at);
+CREATE TABLE IF NOT EXISTS pubsub_offsets (
+	topic TEXT NOT NULL,
+	consumer TEXT NOT NULL,
+	seq INTEGER NOT NULL,
+	PRIMARY KEY (topic, consumer)
+);
+`
+
+// Number of records read from the log per query while replaying.
+const replayBatchSize = 256
+
+// Maximum number of live records buffered for a subscriber. Beyond this the
+// buffer is discarded and the subscriber catches up from the log instead.
+const maxQueuedRecords = replayBatchSize
+
+// Record is a message stored in the log.
+type Record[T any] struct {
+	// Offset of the record in the log, starting from 1.
+	Offset int64
+	// Time the record was published.
+	Time time.Time
+	Msg  T
+}
+
+// Topic is a topic backed by a SQLite log.
+//
+// Every published message is appended to the log before being delivered to
+// live subscribers, so subscribers can replay from any offset.
+type Topic[T any] struct {
+	db    *sql.DB
+	name  string
+	codec pubsub.Codec[T]
+	live  *pubsub.Topic[Record[T]]
+	// Serialises publishing so that live records are in log order, and
+	// closing so that nothing is appended once the topic is closed.
+	lock sync.Mutex
+}
+
+// New creates a durable Topic named "name" in db, creating the schema if
+// necessary.
+//
+// Multiple topics can share a database. Options are applied to the
+// underlying pubsub.Topic used for live delivery.
+func New[T any](ctx context.Context, db *sql.DB, name string, codec pubsub.Codec[T], options ...pubsub.Option) (*Topic[T], error) {
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+	return &Topic[T]{
+		db:    db,
+		name:  name,
+		codec: codec,
+		live:  pubsub.New[Record[T]](options...),
+	}, nil
+}
+
+// Publish appends a message to the log and delivers it to subscribers,
+// returning its offset.
+//
+// The message is durable once Publish returns without error. Returns
+// pubsub.ErrClosed without appending to the log if the topic is closed.
+func (t *Topic[T]) Publish(ctx context.Context, msg T) (offset int64, err error) {
+	payload, err := t.codec.Encode(msg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode message: %w", err)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	select {
+	case <-t.live.Wait():
+		return 0, pubsub.ErrClosed
+	default:
+	}
+	now := time.Now()
+	err = t.db.QueryRowContext(ctx, `
+		INSERT INTO pubsub_log (topic, seq, published_at, payload)
+		SELECT ?, COALESCE(MAX(seq), 0) + 1, ?, ? FROM pubsub_log WHERE topic = ?
+		RETURNING seq
+	`, t.name, now.UnixNano(), payload, t.name).Scan(&offset)
+	if err != nil {
+		return 0, fmt.Errorf("failed to append message: %w", err)
+	}
+	// The record is durable at this point, so it must be delivered
+	// regardless of ctx or live subscribers will see a gap. The topic cannot
+	// be closed while the lock is held.
+	err = t.live.PublishContext(context.Background(), Record[T]{Offset: offset, Time: now, Msg: msg})
+	return offset, err
+}
+
+// OffsetAt returns the offset of the first record published at or after ts.
+//
+// If there is no such record, the offset of the next record to be published
+// is returned.
+func (t *Topic[T]) OffsetAt(ctx context.Context, ts time.Time) (int64, error) {
+	var offset int64
+	err := t.db.QueryRowContext(ctx, `
+		SELECT COALESCE(
+			(SELECT MIN(seq) FROM pubsub_log WHERE topic = ? AND published_at >= ?),
+			(SELECT COALESCE(MAX(seq), 0) + 1 FROM pubsub_log WHERE topic = ?)
+		)
+	`, t.name, ts.UnixNano(), t.name).Scan(&offset)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find offset: %w", err)
+	}
+	return offset, nil
+}
+
+// Commit stores the offset a named consumer should resume from.
+func (t *Topic[T]) Commit(ctx context.Context, consumer string, offset int64) error {
+	_, err := t.db.ExecContext(ctx, `
+		INSERT INTO pubsub_offsets (topic, consumer, seq) VALUES (?, ?, ?)
+		ON CONFLICT (topic, consumer) DO UPDATE SET seq = excluded.seq
+	`, t.name, consumer, offset)
+	if err != nil {
+		return fmt.Errorf("failed to commit offset: %w", err)
+	}
+	return nil
+}
+
+// Offset returns the offset a named consumer should resume from, or 1 if it
+// has not committed one.
+func (t *Topic[T]) Offset(ctx context.Context, consumer string) (int64, error) {
+	var offset int64
+	err := t.db.QueryRowContext(ctx, `SELECT seq FROM pubsub_offsets WHERE topic = ? AND consumer = ?`, t.name, consumer).Scan(&offset)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 1, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to load offset: %w", err)
+	}
+	return offset, nil
+}
+
+// Subscribe to the topic, replaying records from the log starting at offset
+// "from" before switching to live delivery.
+//
+// Every record is delivered exactly once and in order; there are no gaps or
+// duplicates at the switch-over.
+//
+// If "c" is nil a new channel will be created. The channel will be closed
+// when the subscription, the topic, or ctx is closed, or if reading the log
+// fails, in which case the error is available from Subscription.Err.
+func (t *Topic[T]) Subscribe(ctx context.Context, from int64, c chan Record[T]) *Subscription[T] {
+	if c == nil {
+		c = make(chan Record[T], 16)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &Subscription[T]{c: c, cancel: cancel, done: make(chan struct{})}
+	// Subscribe to live records before reading the log, buffering them so
+	// that a slow replay or consumer does not block publishers. Records that
+	// are both in the log and live are skipped by offset.
+	queue := &queue[T]{signal: make(chan struct{}, 1)}
+	unsubscribe := t.live.Handle(func(_ context.Context, rec Record[T]) error {
+		queue.push(rec)
+		return nil
+	})
+	go func() {
+		defer close(sub.done)
+		defer close(c)
+		defer unsubscribe()
+		fail := func(err error) {
+			// Cancellation is not an error.
+			if ctx.Err() == nil {
+				sub.err = err
+			}
+		}
+		next, err := t.replay(ctx, from, c)
+		if err != nil {
+			fail(err)
+			return
+		}
+		for {
+			closed := false
+			select {
+			case <-queue.signal:
+			case <-t.live.Wait():
+				// Deliver anything published before the topic closed.
+				closed = true
+			case <-ctx.Done():
+				return
+			}
+			records, overflowed := queue.take()
+			if overflowed {
+				// Live records were discarded, so catch up from the log.
+				if next, err = t.replay(ctx, next, c); err != nil {
+					fail(err)
+					return
+				}
+			}
+			for _, rec := range records {
+				if rec.Offset < next {
+					continue
+				}
+				select {
+				case c <- rec:
+					next = rec.Offset + 1
+				case <-ctx.Done():
+					return
+				}
+			}
+			if closed {
+				return
+			}
+		}
+	}()
+	return sub
+}
+
+// SubscribeSince subscribes to the topic, replaying records published at or
+// after ts.
+//
+// See Subscribe for details.
+func (t *Topic[T]) SubscribeSince(ctx context.Context, ts time.Time, c chan Record[T]) (*Subscription[T], error) {
+	from, err := t.OffsetAt(ctx, ts)
+	if err != nil {
+		return nil, err
+	}
+	return t.Subscribe(ctx, from, c), nil
+}
+
+// SubscribeConsumer subscribes to the topic, replaying records from the offset
+// last committed by the named consumer.
+//
+// See Subscribe for details.
+func (t *Topic[T]) SubscribeConsumer(ctx context.Context, consumer string, c chan Record[T]) (*Subscription[T], error) {
+	from, err := t.Offset(ctx, consumer)
+	if err != nil {
+		return nil, err
+	}
+	return t.Subscribe(ctx, from, c), nil
+}
+
+// Send records from the log starting at "from" to c, returning the offset of
+// the next record.
+func (t *Topic[T]) replay(ctx context.Context, from int64, c chan Record[T]) (next int64, err error) {
+	next = from
+	for {
+		batch, err := t.read(ctx, next)
+		if err != nil {
+			return 0, err
+		}
+		for _, rec := range batch {
+			select {
+			case c <- rec:
+				next = rec.Offset + 1
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+		if len(batch) < replayBatchSize {
+			return next, nil
+		}
+	}
+}
+
+// Read a batch of records from the log.
+//
+// Rows are not held open while records are delivered, as that would block
+// publishing on databases limited to a single connection.
+func (t *Topic[T]) read(ctx context.Context, from int64) ([]Record[T], error) {
+	rows, err := t.db.QueryContext(ctx, `
+		SELECT seq, published_at, payload FROM pubsub_log
+		WHERE topic = ? AND seq >= ?
+		ORDER BY seq
+		LIMIT ?
+	`, t.name, from, replayBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+	defer rows.Close()
+	batch := []Record[T]{}
+	for rows.Next() {
+		var (
+			rec     Record[T]
+			ts      int64
+			payload []byte
+		)
+		if err := rows.Scan(&rec.Offset, &ts, &payload); err != nil {
+			return nil, fmt.Errorf("failed to read log: %w", err)
+		}
+		rec.Time = time.Unix(0, ts)
+		rec.Msg, err = t.codec.Decode(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode record %d: %w", rec.Offset, err)
+		}
+		batch = append(batch, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+	return batch, nil
+}
+
+// Wait returns a channel that will be closed when the Topic is closed.
+func (t *Topic[T]) Wait() chan struct{} {
+	return t.live.Wait()
+}
+
+// Close the topic, closing all subscriptions.
+//
+// The database is not closed.
+func (t *Topic[T]) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.live.Close()
+}
+
+// Subscription to a durable Topic.
+type Subscription[T any] struct {
+	c      chan Record[T]
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// C returns the channel records are delivered on.
+func (s *Subscription[T]) C() <-chan Record[T] { return s.c }
+
+// Close the subscription, blocking until its channel is closed.
+//
+// Returns any error that terminated replay.
+func (s *Subscription[T]) Close() error {
+	s.cancel()
+	// Discard undelivered records so the subscription goroutine can exit.
+	go func() {
+		for range s.c {
+		}
+	}()
+	<-s.done
+	return s.err
+}
+
+// Err returns the error that terminated replay, if any, once the channel is
+// closed.
+func (s *Subscription[T]) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// A FIFO queue of records, bounded by maxQueuedRecords.
+type queue[T any] struct {
+	lock    sync.Mutex
+	records []Record[T]
+	// Set if records were discarded because the queue was full.
+	overflowed bool
+	// Signalled when records are pushed.
+	signal chan struct{}
+}
+
+func (q *queue[T]) push(rec Record[T]) {
+	q.lock.Lock()
+	if len(q.records) >= maxQueuedRecords {
+		q.records = nil
+		q.overflowed = true
+	}
+	q.records = append(q.records, rec)
+	q.lock.Unlock()
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Take all queued records, and whether any were discarded since the last take.
+func (q *queue[T]) take() (records []Record[T], overflowed bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	records, overflowed = q.records, q.overflowed
+	q.records, q.overflowed = nil, false
+	return records, overflowed
+}
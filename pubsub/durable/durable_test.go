@@ -0,0 +1,160 @@
+package durable_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/types/pubsub"
+	. "github.com/alecthomas/types/pubsub/durable" //nolint
+	_ "modernc.org/sqlite"                         // Register SQLite driver.
+)
+
+func TestDurableReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "pubsub.db")
+	db := openDB(t, path)
+	topic, err := New(ctx, db, "events", pubsub.JSONCodec[string]{})
+	assert.NoError(t, err)
+	for _, msg := range []string{"a", "b", "c"} {
+		_, err := topic.Publish(ctx, msg)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, topic.Commit(ctx, "consumer", 2))
+	_ = topic.Close()
+	_ = db.Close()
+
+	// Reopen as if after a restart.
+	db = openDB(t, path)
+	topic, err = New(ctx, db, "events", pubsub.JSONCodec[string]{})
+	assert.NoError(t, err)
+	defer topic.Close() //nolint
+	sub, err := topic.SubscribeConsumer(ctx, "consumer", nil)
+	assert.NoError(t, err)
+	defer sub.Close() //nolint
+	assert.Equal(t, []string{"b", "c"}, receive(t, sub, 2))
+
+	offset, err := topic.Publish(ctx, "d")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), offset)
+	assert.Equal(t, []string{"d"}, receive(t, sub, 1))
+}
+
+func TestDurableNoGapsAtSwitchOver(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, filepath.Join(t.TempDir(), "pubsub.db"))
+	topic, err := New(ctx, db, "events", pubsub.JSONCodec[int]{})
+	assert.NoError(t, err)
+	defer topic.Close() //nolint
+
+	const count = 200
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := range count {
+			_, err := topic.Publish(ctx, i)
+			assert.NoError(t, err)
+		}
+	}()
+	time.Sleep(time.Millisecond * 10)
+	sub := topic.Subscribe(ctx, 1, nil)
+	defer sub.Close() //nolint
+	<-published
+	expected := make([]int, count)
+	for i := range expected {
+		expected[i] = i
+	}
+	assert.Equal(t, expected, receive(t, sub, count))
+}
+
+func TestDurableSubscribeSince(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, filepath.Join(t.TempDir(), "pubsub.db"))
+	topic, err := New(ctx, db, "events", pubsub.JSONCodec[string]{})
+	assert.NoError(t, err)
+	defer topic.Close() //nolint
+	_, err = topic.Publish(ctx, "old")
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+	since := time.Now()
+	_, err = topic.Publish(ctx, "new")
+	assert.NoError(t, err)
+
+	// Topics sharing a database are independent.
+	other, err := New(ctx, db, "other", pubsub.JSONCodec[string]{})
+	assert.NoError(t, err)
+	defer other.Close() //nolint
+	_, err = other.Publish(ctx, "other")
+	assert.NoError(t, err)
+
+	sub, err := topic.SubscribeSince(ctx, since, nil)
+	assert.NoError(t, err)
+	defer sub.Close() //nolint
+	assert.Equal(t, []string{"new"}, receive(t, sub, 1))
+}
+
+func TestDurablePublishAfterClose(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, filepath.Join(t.TempDir(), "pubsub.db"))
+	topic, err := New(ctx, db, "events", pubsub.JSONCodec[string]{})
+	assert.NoError(t, err)
+	assert.NoError(t, topic.Close())
+	_, err = topic.Publish(ctx, "lost")
+	assert.IsError(t, err, pubsub.ErrClosed)
+	// Nothing should have been appended to the log.
+	next, err := topic.OffsetAt(ctx, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), next)
+}
+
+func TestDurableSlowSubscriber(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, filepath.Join(t.TempDir(), "pubsub.db"))
+	topic, err := New(ctx, db, "events", pubsub.JSONCodec[int]{})
+	assert.NoError(t, err)
+	defer topic.Close() //nolint
+	sub := topic.Subscribe(ctx, 1, nil)
+	defer sub.Close() //nolint
+
+	// Publish more than can be buffered for the subscriber, which must then
+	// catch up from the log.
+	const count = 400
+	expected := make([]int, count)
+	for i := range expected {
+		expected[i] = i
+		_, err := topic.Publish(ctx, i)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, expected, receive(t, sub, count))
+}
+
+func openDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func receive[T any](t *testing.T, sub *Subscription[T], n int) []T {
+	t.Helper()
+	out := []T{}
+	last := int64(0)
+	for range n {
+		select {
+		case rec := <-sub.C():
+			if last != 0 {
+				assert.Equal(t, last+1, rec.Offset, "records should be contiguous")
+			}
+			last = rec.Offset
+			out = append(out, rec.Msg)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out after receiving %d of %d records", len(out), n)
+		}
+	}
+	return out
+}
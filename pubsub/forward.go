@@ -0,0 +1,88 @@
+package pubsub
+
+import "sync/atomic"
+
+// OverflowPolicy controls what happens when the channel of an asynchronous
+// subscription is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for the subscriber to receive the message, which
+	// blocks delivery to all other subscribers.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the new message.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest buffered message to make room for
+	// the new one.
+	OverflowDropOldest
+	// OverflowCoalesce discards all buffered messages so that the subscriber
+	// only receives the latest.
+	OverflowCoalesce
+)
+
+// A forwarder acks messages from the Topic on behalf of an asynchronous
+// subscriber and forwards them to the subscriber's channel.
+type forwarder[T any] struct {
+	forward   chan Message[T]
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// Forward messages to "c" until the Topic closes the forward channel, then
+// close "c".
+func (f *forwarder[T]) run(c chan T, overflow OverflowPolicy) {
+	for msg := range f.forward {
+		f.send(c, msg.Msg, overflow)
+		msg.Ack()
+	}
+	close(c)
+}
+
+func (f *forwarder[T]) send(c chan T, msg T, overflow OverflowPolicy) {
+	// An unbuffered channel has no old messages to discard.
+	if cap(c) == 0 && overflow != OverflowBlock {
+		overflow = OverflowDropNewest
+	}
+	switch overflow {
+	case OverflowDropNewest:
+		if !f.trySend(c, msg) {
+			f.dropped.Add(1)
+		}
+
+	case OverflowDropOldest:
+		for !f.trySend(c, msg) {
+			f.tryDrop(c)
+		}
+
+	case OverflowCoalesce:
+		for !f.trySend(c, msg) {
+			for f.tryDrop(c) {
+			}
+		}
+
+	default:
+		c <- msg
+		f.delivered.Add(1)
+	}
+}
+
+func (f *forwarder[T]) trySend(c chan T, msg T) bool {
+	select {
+	case c <- msg:
+		f.delivered.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+// The subscriber may receive concurrently, so there may be nothing to drop.
+func (f *forwarder[T]) tryDrop(c chan T) bool {
+	select {
+	case <-c:
+		f.dropped.Add(1)
+		return true
+	default:
+		return false
+	}
+}
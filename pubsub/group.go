@@ -0,0 +1,90 @@
+package pubsub
+
+import (
+	"errors"
+	"slices"
+	"sort"
+)
+
+// GroupBalancing controls which member of a consumer group a message is
+// assigned to.
+type GroupBalancing int
+
+const (
+	// BalanceRoundRobin assigns messages to each member in turn.
+	BalanceRoundRobin GroupBalancing = iota
+	// BalanceLeastLoaded assigns messages to the member that has spent the
+	// least time handling messages, measured from delivery to ack, falling
+	// back to round-robin. Slow members therefore receive fewer messages.
+	//
+	// New members start level with the least loaded existing member.
+	BalanceLeastLoaded
+)
+
+// Order the members of a consumer group by preference for the next message.
+//
+// Must be called from the run goroutine.
+func (s *Topic[T]) balance(group string, members []subscribe[T]) []subscribe[T] {
+	sort.Slice(members, func(i, j int) bool { return members[i].seq < members[j].seq })
+	start := s.groupCursors[group] % len(members)
+	s.groupCursors[group]++
+	members = slices.Concat(members[start:], members[:start])
+	if s.options.groupBalancing == BalanceLeastLoaded {
+		sort.SliceStable(members, func(i, j int) bool { return members[i].stats.busy.Load() < members[j].stats.busy.Load() })
+	}
+	return members
+}
+
+// The least time any member of a consumer group has spent handling messages.
+//
+// Must be called from the run goroutine.
+func (s *Topic[T]) groupBusy(group string) (busy int64) {
+	first := true
+	for _, sub := range s.subscriptions {
+		if sub.group == group && (first || sub.stats.busy.Load() < busy) {
+			busy, first = sub.stats.busy.Load(), false
+		}
+	}
+	return busy
+}
+
+// Forget the round-robin position of a consumer group once it has no members.
+//
+// Must be called from the run goroutine.
+func (s *Topic[T]) forgetGroup(group string) {
+	for _, sub := range s.subscriptions {
+		if sub.group == group {
+			return
+		}
+	}
+	delete(s.groupCursors, group)
+}
+
+// Deliver a message to the first member of a consumer group, reassigning it to
+// the next member each time it is nacked or times out.
+//
+// If every member fails, the errors are joined and the message is sent to the
+// dead letter topic of the last member, if any.
+func (s *Topic[T]) deliverGroup(members []subscribe[T], msg Message[T]) []deliveryResult[T] {
+	results := make([]deliveryResult[T], 0, len(members))
+	errs := make([]error, 0, len(members))
+	total := 0
+	for _, sub := range members {
+		drop, timedOut, attempts, err := s.attempt(sub, msg)
+		results = append(results, deliveryResult[T]{sub: sub, drop: drop})
+		if err == nil {
+			return results
+		}
+		msg.Attempt += attempts
+		errs = append(errs, err)
+		if !timedOut {
+			total += attempts
+		}
+	}
+	err := errors.Join(errs...)
+	if total > 0 {
+		s.deadLetter(members[len(members)-1], msg, total, err)
+	}
+	results[len(results)-1].err = err
+	return results
+}
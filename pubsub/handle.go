@@ -0,0 +1,73 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Handle subscribes a callback to the topic.
+//
+// Each message is passed to handler and acked if it returns nil, or nacked
+// with the returned error otherwise. A panic in handler is recovered and
+// nacked as an error. Errors are returned to synchronous publishers, and
+// nacked messages are subject to the redelivery options of SubscribeSync.
+//
+// The context passed to handler is cancelled when the subscription is closed.
+// Messages in flight when unsubscribing are acked, as are any errors the
+// handler returns once its context is cancelled.
+//
+// The returned function unsubscribes the handler, blocking until any
+// in-flight call has returned. It is safe to call more than once. As it waits
+// for the handler, it must not be called from within the handler itself or the
+// topic deadlocks until the ack timeout; use "go unsubscribe()" instead.
+//
+// If the topic is closed the handler is never called.
+func (s *Topic[T]) Handle(handler func(ctx context.Context, msg T) error, options ...SubscribeOption) (unsubscribe func()) {
+	return s.handle(handler, options, getSubscriber())
+}
+
+func (s *Topic[T]) handle(handler func(ctx context.Context, msg T) error, options []SubscribeOption, subscriber string) (unsubscribe func()) {
+	ch, err := s.subscribeSync(context.Background(), nil, nil, options, subscriber)
+	if err != nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		for msg := range ch {
+			if ctx.Err() != nil {
+				// Unsubscribing, so discard the message rather than calling
+				// handler.
+				msg.Ack()
+				continue
+			}
+			// Errors caused by unsubscribing are not nacked, so that
+			// unsubscribing never triggers redelivery or dead-lettering.
+			if err := callHandler(ctx, handler, msg.Msg); err != nil && ctx.Err() == nil {
+				msg.Nack(err)
+			} else {
+				msg.Ack()
+			}
+		}
+	}()
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			cancel()
+			_ = s.UnsubscribeSyncContext(context.Background(), ch)
+			<-done
+		})
+	}
+}
+
+func callHandler[T any](ctx context.Context, handler func(context.Context, T) error, msg T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, msg)
+}
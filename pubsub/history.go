@@ -0,0 +1,65 @@
+package pubsub
+
+import "slices"
+
+// Retain a delivered message in the history, if enabled.
+func (s *Topic[T]) retain(msg Message[T]) {
+	if s.options.historySize <= 0 && s.options.historyAge <= 0 {
+		return
+	}
+	// There is no publisher waiting for replayed messages.
+	msg.ack = nil
+	msg.sync = false
+	s.history = append(s.history, msg)
+	if s.options.historySize > 0 && len(s.history) > s.options.historySize {
+		s.history = s.history[len(s.history)-s.options.historySize:]
+	}
+	s.expireHistory()
+}
+
+func (s *Topic[T]) expireHistory() {
+	if s.options.historyAge <= 0 {
+		return
+	}
+	cutoff := s.options.clock.Now().Add(-s.options.historyAge)
+	i := 0
+	for i < len(s.history) && s.history[i].Time.Before(cutoff) {
+		i++
+	}
+	// Copy rather than reslice so expired messages can be collected.
+	if i > 0 {
+		s.history = append([]Message[T](nil), s.history[i:]...)
+	}
+}
+
+// Replay the history to a new subscriber.
+//
+// As this is called by the run goroutine before the subscription is added,
+// there are no gaps or duplicates between replayed and live messages.
+//
+// Members of consumer groups do not receive the history, as it would be
+// processed by the group more than once.
+//
+// Returns true if the subscriber was dropped by the slow subscriber policy.
+func (s *Topic[T]) replay(sub subscribe[T]) (drop bool) {
+	if sub.group != "" {
+		return false
+	}
+	s.expireHistory()
+	history := s.history
+	if sub.replayAfter != "" {
+		if i := slices.IndexFunc(history, func(msg Message[T]) bool { return msg.ID == sub.replayAfter }); i >= 0 {
+			history = history[i+1:]
+		}
+	}
+	for _, msg := range history {
+		if sub.filter != nil && !sub.filter(msg.Msg) {
+			continue
+		}
+		// There is no publisher waiting for the result.
+		if drop, _ := s.deliver(sub, msg); drop {
+			return true
+		}
+	}
+	return false
+}
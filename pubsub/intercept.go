@@ -0,0 +1,65 @@
+package pubsub
+
+import "fmt"
+
+// PublishInterceptor intercepts each message published to a Topic.
+//
+// It is called by the topic before the message is delivered, and must call
+// next to deliver it. It may modify the message passed to next, or reject the
+// message by returning an error without calling next. The error returned by
+// next is the result of delivering the message to all subscribers, and the
+// error returned by the interceptor is returned to synchronous publishers.
+//
+// Interceptors are called serially by the topic, so they must not block or
+// call back into the topic.
+type PublishInterceptor[T any] func(msg Message[T], next func(Message[T]) error) error
+
+// DeliveryInterceptor intercepts each delivery of a message to a subscriber,
+// including redeliveries and replayed history.
+//
+// It must call next to deliver the message to the subscriber, and may modify
+// the message passed to next. The error returned by next is the ack or nack
+// from the subscriber. Returning an error without calling next rejects the
+// delivery, which is then treated as a nack.
+//
+// As for PublishInterceptor, delivery interceptors must not block.
+type DeliveryInterceptor[T any] func(subscriber string, msg Message[T], next func(Message[T]) error) error
+
+// Type-assert interceptors stored by the untyped options.
+func typedInterceptors[I any](kind string, interceptors []any) []I {
+	out := make([]I, 0, len(interceptors))
+	for _, interceptor := range interceptors {
+		typed, ok := interceptor.(I)
+		if !ok {
+			panic(fmt.Sprintf("%s interceptor %T is not a %T", kind, interceptor, *new(I)))
+		}
+		out = append(out, typed)
+	}
+	return out
+}
+
+// Pass a published message through the publish interceptors to deliver.
+//
+// The first interceptor is outermost.
+func (s *Topic[T]) interceptPublish(msg Message[T], deliver func(Message[T]) error) error {
+	next := deliver
+	for i := len(s.publishInterceptors) - 1; i >= 0; i-- {
+		interceptor, inner := s.publishInterceptors[i], next
+		next = func(msg Message[T]) error { return interceptor(msg, inner) }
+	}
+	return next(msg)
+}
+
+// Pass a delivery through the delivery interceptors to deliverOnce.
+func (s *Topic[T]) interceptDelivery(sub subscribe[T], msg Message[T]) (drop, timedOut bool, err error) {
+	next := func(msg Message[T]) error {
+		drop, timedOut, err = s.deliverOnce(sub, msg)
+		return err
+	}
+	for i := len(s.deliveryInterceptors) - 1; i >= 0; i-- {
+		interceptor, inner := s.deliveryInterceptors[i], next
+		next = func(msg Message[T]) error { return interceptor(sub.subscriber, msg, inner) }
+	}
+	err = next(msg)
+	return drop, timedOut, err
+}
@@ -0,0 +1,80 @@
+package pubsub
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// All returns an iterator over messages published to the topic.
+//
+// The topic is subscribed to when iteration starts, and unsubscribed from
+// when the loop exits, ctx is done, or the topic is closed.
+//
+// Subscription options are as for Subscribe.
+func (s *Topic[T]) All(ctx context.Context, options ...SubscribeOption) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		sub, err := s.subscribe(ctx, nil, nil, options, getSubscriber())
+		if err != nil {
+			return
+		}
+		defer sub.Close() //nolint
+		for {
+			select {
+			case msg, ok := <-sub.c:
+				if !ok || !yield(msg) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// AllSync returns an iterator over messages published to the topic, along
+// with a function to ack (nil) or nack (non-nil error) each message.
+//
+// If the loop body does not call the ack function the message is acked once
+// the body completes. Calling it more than once has no effect.
+//
+// The topic is subscribed to when iteration starts, and unsubscribed from
+// when the loop exits, ctx is done, or the topic is closed. Messages in flight
+// when the iterator unsubscribes are acked without being yielded, so they are
+// not redelivered or dead-lettered.
+//
+// Subscription options are as for SubscribeSync.
+func (s *Topic[T]) AllSync(ctx context.Context, options ...SubscribeOption) iter.Seq2[T, func(error)] {
+	return func(yield func(T, func(error)) bool) {
+		ch, err := s.subscribeSync(ctx, nil, nil, options, getSubscriber())
+		if err != nil {
+			return
+		}
+		defer unsubscribeDraining(s, ch)
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				once := sync.Once{}
+				ack := func(err error) {
+					once.Do(func() {
+						if err != nil {
+							msg.Nack(err)
+						} else {
+							msg.Ack()
+						}
+					})
+				}
+				more := yield(msg.Msg, ack)
+				ack(nil)
+				if !more {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
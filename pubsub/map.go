@@ -0,0 +1,70 @@
+package pubsub
+
+import "context"
+
+// Map returns a new Topic that receives every message published to topic,
+// transformed by fn.
+//
+// The returned Topic is synchronously subscribed to topic, so a synchronous
+// publish to topic will not complete until subscribers of the returned Topic
+// have acked the transformed message, and any errors are propagated.
+//
+// Headers are copied to the transformed message, which otherwise has its own
+// ID and publish time.
+//
+// The returned Topic is closed when topic is closed, and closing the returned
+// Topic unsubscribes it from topic. Options are applied to the returned Topic.
+func Map[T, U any](topic *Topic[T], fn func(T) U, options ...Option) *Topic[U] {
+	out := New[U](options...)
+	relay(topic, out, getSubscriber(), func(msg Message[T]) error {
+		return out.PublishSync(fn(msg.Msg), WithHeaders(msg.Headers))
+	}, func() { _ = out.Close() })
+	return out
+}
+
+// Relay messages from topic to out until either is closed.
+//
+// Each message is passed to handle and acked, or nacked with the error it
+// returns. "done" is called once topic is closed, and closing out unsubscribes
+// from topic.
+func relay[T, U any](topic *Topic[T], out *Topic[U], subscriber string, handle func(Message[T]) error, done func()) {
+	in, err := topic.subscribeSync(context.Background(), nil, nil, nil, subscriber)
+	if err != nil {
+		done()
+		return
+	}
+	go func() {
+		for {
+			select {
+			case msg, ok := <-in:
+				if !ok {
+					done()
+					return
+				}
+				if err := handle(msg); err != nil {
+					msg.Nack(err)
+				} else {
+					msg.Ack()
+				}
+
+			case <-out.Wait():
+				unsubscribeDraining(topic, in)
+				return
+			}
+		}
+	}()
+}
+
+// Unsubscribe a synchronous subscription, acking anything in flight so that
+// the topic is not blocked while we unsubscribe.
+//
+// Messages are acked rather than nacked so that unsubscribing never triggers
+// redelivery or dead-lettering of messages the subscriber never saw.
+func unsubscribeDraining[T any](topic *Topic[T], in chan Message[T]) {
+	go func() {
+		for msg := range in {
+			msg.Ack()
+		}
+	}()
+	_ = topic.UnsubscribeSyncContext(context.Background(), in)
+}
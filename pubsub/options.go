@@ -0,0 +1,301 @@
+package pubsub
+
+import "time"
+
+// Option configures a Topic.
+type Option func(*options)
+
+type options struct {
+	ackTimeout       time.Duration
+	publishTimeout   time.Duration
+	publishBuffer    int
+	subscriberBuffer int
+	parallelDelivery bool
+	historySize      int
+	historyAge       time.Duration
+	groupBalancing   GroupBalancing
+
+	slowSubscriberPolicy SlowSubscriberPolicy
+	clock                Clock
+	// PublishInterceptor[T] and DeliveryInterceptor[T], untyped because
+	// Option is not generic.
+	publishInterceptors  []any
+	deliveryInterceptors []any
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		ackTimeout:       AckTimeout,
+		publishBuffer:    16384,
+		subscriberBuffer: 16,
+		clock:            realClock{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithAckTimeout sets the time to wait for a subscriber to ack a message.
+//
+// Defaults to AckTimeout.
+func WithAckTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.ackTimeout = timeout }
+}
+
+// WithPublishTimeout sets the time Publish will wait for space in the publish
+// queue before panicking, such as PublishTimeout.
+//
+// By default Publish blocks until there is space. Use PublishContext to bound
+// a single publish without panicking.
+func WithPublishTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.publishTimeout = timeout }
+}
+
+// WithPublishBuffer sets the number of messages that can be queued for
+// publishing before Publish blocks, across all priorities.
+//
+// Defaults to 16384.
+func WithPublishBuffer(size int) Option {
+	return func(o *options) { o.publishBuffer = size }
+}
+
+// WithDefaultSubscriberBuffer sets the size of the channel created by Subscribe
+// and SubscribeSync when passed a nil channel.
+//
+// Defaults to 16.
+func WithDefaultSubscriberBuffer(size int) Option {
+	return func(o *options) { o.subscriberBuffer = size }
+}
+
+// WithParallelDelivery delivers each message to all subscribers concurrently,
+// rather than one at a time.
+//
+// A synchronous publish completes once every subscriber has acked, with the
+// errors joined. Messages are still delivered in order to each subscriber.
+//
+// Note that in this mode the slow subscriber policy may be called
+// concurrently.
+func WithParallelDelivery() Option {
+	return func(o *options) { o.parallelDelivery = true }
+}
+
+// WithHistory retains the last "size" messages published to the topic and
+// replays them to each new subscriber before any live messages.
+//
+// It can be combined with WithHistoryDuration.
+func WithHistory(size int) Option {
+	return func(o *options) { o.historySize = size }
+}
+
+// WithHistoryDuration retains messages published to the topic within the
+// last "age" and replays them to each new subscriber before any live
+// messages.
+//
+// It can be combined with WithHistory.
+func WithHistoryDuration(age time.Duration) Option {
+	return func(o *options) { o.historyAge = age }
+}
+
+// WithGroupBalancing sets how messages are assigned to members of consumer
+// groups.
+//
+// Defaults to BalanceRoundRobin.
+func WithGroupBalancing(balancing GroupBalancing) Option {
+	return func(o *options) { o.groupBalancing = balancing }
+}
+
+// SlowSubscriberAction is the action a Topic takes when a subscriber fails to
+// accept or ack a message within the ack timeout.
+type SlowSubscriberAction int
+
+const (
+	// SlowSubscriberPanic panics with the identity of the subscriber.
+	//
+	// This is the default.
+	SlowSubscriberPanic SlowSubscriberAction = iota
+	// SlowSubscriberDrop unsubscribes the subscriber and closes its channel.
+	//
+	// ErrAckTimeout is reported to the publisher.
+	SlowSubscriberDrop
+	// SlowSubscriberSkip skips the message for the subscriber, which remains
+	// subscribed.
+	//
+	// ErrAckTimeout is reported to the publisher.
+	SlowSubscriberSkip
+)
+
+// SlowSubscriberPolicy is called with the identity of a subscriber that failed
+// to ack a message within the ack timeout, and returns the action to take.
+//
+// The identity is the "file:line: function" of the code that subscribed.
+//
+// The policy is called from the Topic's delivery goroutine, so it must not
+// block or call back into the Topic.
+type SlowSubscriberPolicy func(subscriber string) SlowSubscriberAction
+
+// WithClock sets the Clock used for timeouts, redelivery backoff, message
+// times and history expiry. When applied to the Topic returned by Batch,
+// Debounce or Throttle it is also used for their timers.
+//
+// Defaults to the system clock.
+func WithClock(clock Clock) Option {
+	return func(o *options) { o.clock = clock }
+}
+
+// WithPublishInterceptor adds an interceptor that is called for every message
+// published to the topic.
+//
+// Interceptors are called in the order they are added. The interceptor must be
+// for the type of the topic, or New will panic.
+func WithPublishInterceptor[T any](interceptor PublishInterceptor[T]) Option {
+	return func(o *options) { o.publishInterceptors = append(o.publishInterceptors, interceptor) }
+}
+
+// WithDeliveryInterceptor adds an interceptor that is called for every
+// delivery of a message to a subscriber.
+//
+// Interceptors are called in the order they are added. The interceptor must be
+// for the type of the topic, or New will panic.
+func WithDeliveryInterceptor[T any](interceptor DeliveryInterceptor[T]) Option {
+	return func(o *options) { o.deliveryInterceptors = append(o.deliveryInterceptors, interceptor) }
+}
+
+// WithSlowSubscriberPolicy sets the policy applied when a subscriber fails to
+// ack a message within the ack timeout.
+func WithSlowSubscriberPolicy(policy SlowSubscriberPolicy) Option {
+	return func(o *options) { o.slowSubscriberPolicy = policy }
+}
+
+// WithSlowSubscriberAction applies the same action to every subscriber that
+// fails to ack a message within the ack timeout.
+func WithSlowSubscriberAction(action SlowSubscriberAction) Option {
+	return WithSlowSubscriberPolicy(func(string) SlowSubscriberAction { return action })
+}
+
+// SubscribeOption configures a subscription.
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	group       string
+	overflow    OverflowPolicy
+	redelivery  RedeliveryPolicy
+	replayAfter string
+	// A func(DeadLetter[T]) for the subscribed Topic[T]. This can't be typed
+	// as the subscription would refer to Topic[DeadLetter[T]], which is an
+	// instantiation cycle.
+	deadLetter any
+}
+
+func newSubscribeOptions(opts []SubscribeOption) subscribeOptions {
+	o := subscribeOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithOverflow sets the policy applied when the channel of an asynchronous
+// subscription is full.
+//
+// Defaults to OverflowBlock.
+func WithOverflow(policy OverflowPolicy) SubscribeOption {
+	return func(o *subscribeOptions) { o.overflow = policy }
+}
+
+// WithRedelivery redelivers messages nacked by a synchronous subscriber
+// according to policy.
+//
+// Redelivery, including the backoff between attempts, completes before the
+// topic delivers the next message or handles Subscribe, Unsubscribe or Close,
+// so backoff stalls the whole topic even with WithParallelDelivery.
+//
+// Unless a slow subscriber policy is set, PublishSync gives up waiting after
+// the ack timeout and returns nil, so with a total backoff longer than the ack
+// timeout PublishSync may return nil for a message that is later nacked and
+// dead-lettered.
+func WithRedelivery(policy RedeliveryPolicy) SubscribeOption {
+	return func(o *subscribeOptions) { o.redelivery = policy }
+}
+
+// WithDeadLetter publishes messages that are still nacked by a synchronous
+// subscriber once redelivery attempts are exhausted to the given topic.
+//
+// The topic must be of type *Topic[DeadLetter[T]] for a subscription to a
+// Topic[T], or subscribing will panic.
+//
+// Dead letters are published without blocking, so if the dead letter topic is
+// closed or its publish queue is full they are discarded and counted in
+// SubscriberStats.DeadLettersDropped.
+func WithDeadLetter[T any](topic *Topic[DeadLetter[T]]) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.deadLetter = func(msg DeadLetter[T]) error {
+			return topic.tryEnqueue(topic.newMessage(msg, []PublishOption{WithHeaders(msg.Headers)}))
+		}
+	}
+}
+
+// ReplayAfter replays only the history published after the message with the
+// given ID, allowing a subscriber to resume where it left off.
+//
+// If the message is no longer in the history, the entire history is
+// replayed.
+func ReplayAfter(id string) SubscribeOption {
+	return func(o *subscribeOptions) { o.replayAfter = id }
+}
+
+// InGroup makes the subscriber a member of the named consumer group.
+//
+// Each message is delivered to only one member of a group, chosen according
+// to WithGroupBalancing. If that member nacks the message or fails to ack it
+// in time, it is reassigned to the next member. The group as a whole behaves
+// like a single subscriber, so publishers see an error only if every member
+// fails.
+//
+// Members do not receive replayed history.
+func InGroup(group string) SubscribeOption {
+	return func(o *subscribeOptions) { o.group = group }
+}
+
+// PublishOption configures a single published message.
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	id       string
+	headers  map[string]string
+	priority Priority
+}
+
+// WithMessageID sets the ID of a published message, such as an ID from an
+// upstream system that subscribers can use to deduplicate.
+//
+// Defaults to a random ID.
+func WithMessageID(id string) PublishOption {
+	return func(o *publishOptions) { o.id = id }
+}
+
+// WithPriority sets the priority of a published message.
+//
+// Defaults to PriorityNormal.
+func WithPriority(priority Priority) PublishOption {
+	return func(o *publishOptions) { o.priority = priority }
+}
+
+// WithHeader adds a header to a published message.
+func WithHeader(key, value string) PublishOption {
+	return func(o *publishOptions) {
+		if o.headers == nil {
+			o.headers = map[string]string{}
+		}
+		o.headers[key] = value
+	}
+}
+
+// WithHeaders adds headers to a published message.
+func WithHeaders(headers map[string]string) PublishOption {
+	return func(o *publishOptions) {
+		for key, value := range headers {
+			WithHeader(key, value)(o)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package pubsub
+
+// Priority of a published message, set with WithPriority.
+//
+// Queued messages of higher priority are delivered before queued messages of
+// lower priority, while messages of the same priority are delivered in the
+// order they were published. A message that is already being delivered is not
+// interrupted.
+type Priority int
+
+const (
+	// PriorityLow is for bulk traffic that can wait behind other messages.
+	PriorityLow Priority = iota - 1
+	// PriorityNormal is the default.
+	PriorityNormal
+	// PriorityHigh is for control messages that should not wait behind
+	// other messages.
+	PriorityHigh
+)
+
+// The number of priority levels.
+const priorities = 3
+
+// Index of the priority in Topic.queues, clamping unknown priorities.
+func (p Priority) index() int {
+	return min(max(int(p-PriorityLow), 0), priorities-1)
+}
+
+// Queue a message for delivery. The caller must hold a slot.
+func (s *Topic[T]) queue(msg Message[T]) {
+	i := msg.priority.index()
+	s.queueLock.Lock()
+	s.queues[i] = append(s.queues[i], msg)
+	s.queueLock.Unlock()
+	select {
+	case s.queued <- struct{}{}:
+	default:
+	}
+}
+
+// Remove the oldest queued message of the highest priority, releasing its
+// slot.
+func (s *Topic[T]) dequeue() (Message[T], bool) {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	for i := priorities - 1; i >= 0; i-- {
+		if len(s.queues[i]) == 0 {
+			continue
+		}
+		msg := s.queues[i][0]
+		// Release the message so it can be collected.
+		s.queues[i][0] = Message[T]{}
+		s.queues[i] = s.queues[i][1:]
+		<-s.slots
+		return msg, true
+	}
+	return Message[T]{}, false
+}
+
+// The number of published messages waiting to be delivered.
+func (s *Topic[T]) queueDepth() int {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	depth := 0
+	for _, queue := range s.queues {
+		depth += len(queue)
+	}
+	return depth
+}
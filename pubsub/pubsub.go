@@ -4,25 +4,56 @@
 package pubsub
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"runtime"
+	"slices"
 	"sync"
 	"time"
 )
 
-// AckTimeout is the time to wait for an ack before panicking.
+// AckTimeout is the default time to wait for an ack before panicking.
+//
+// It can be overridden per Topic with WithAckTimeout.
 //
 // This is a last-ditch effort to avoid deadlocks.
 const AckTimeout = time.Second * 30
 
-// PublishTimeout is the time to wait for a publish before panicking.
+// PublishTimeout is a suggested time for Publish to wait before panicking, for
+// use with WithPublishTimeout.
+//
+// By default Publish blocks until there is space in the publish queue.
 const PublishTimeout = time.Second * 10
 
+// ErrClosed is returned by operations on a closed Topic or Router.
+var ErrClosed = errors.New("closed")
+
+// ErrAckTimeout is returned by PublishSync when a subscriber fails to ack a
+// message within the ack timeout and the slow subscriber policy does not panic.
+var ErrAckTimeout = errors.New("ack timeout")
+
 // Message is a message that must be acknowledge by the receiver.
 type Message[T any] struct {
 	Msg T
-	ack chan error
+	// ID uniquely identifies the message. It is the same for every subscriber
+	// and every delivery of the message, including redeliveries and replays.
+	ID string
+	// Time the message was published.
+	Time time.Time
+	// Headers supplied by the publisher with WithHeader. They are shared
+	// between subscribers and must not be modified.
+	Headers map[string]string
+	// Attempt is the delivery attempt of the message to this subscriber,
+	// starting from 1. For consumer groups it counts attempts across all
+	// members.
+	Attempt int
+	ack     chan error
+	// True if the publisher is waiting for the result.
+	sync     bool
+	priority Priority
 }
 
 func (a *Message[T]) Ack() { close(a.ack) }
@@ -40,6 +71,17 @@ type control[T any] interface{ control() }
 type subscribe[T any] struct {
 	subscriber string
 	msg        chan Message[T]
+	// If non-nil, only messages matching the filter are delivered.
+	filter func(T) bool
+	// If non-empty, the consumer group the subscriber is a member of.
+	group      string
+	redelivery RedeliveryPolicy
+	deadLetter func(DeadLetter[T]) error
+	// If non-empty, only history after the message with this ID is replayed.
+	replayAfter string
+	// Set by the run goroutine.
+	seq   uint64
+	stats *subscriberStats
 }
 
 func (subscribe[T]) control() {}
@@ -56,20 +98,59 @@ type Topic[T any] struct {
 	// This map is used by Unsubscribe() because the non-ackable channel is not
 	// the same as the ackable channel.
 	//
-	// If this were typed it would be map[chan T]chan Message[T]
+	// If this were typed it would be map[chan T]*Subscription[T]
 	rawChannelMap sync.Map
-	publish       chan Message[T]
+	options       options
 	control       chan control[T]
+	// Owned by the run goroutine, which must hold lock when modifying it so
+	// that it can be read by Stats.
+	subscriptions map[chan Message[T]]subscribe[T]
+	lock          sync.RWMutex
+	// Owned by the run goroutine.
+	history []Message[T]
+	seq     uint64
+	// Owned by the run goroutine, the round-robin position of each consumer
+	// group.
+	groupCursors         map[string]int
+	publishInterceptors  []PublishInterceptor[T]
+	deliveryInterceptors []DeliveryInterceptor[T]
+	// Published messages waiting to be delivered, by priority.
+	queueLock sync.Mutex
+	queues    [priorities][]Message[T]
+	// Holds a token for each queued message, so that publishers block once
+	// the publish buffer is full regardless of priority.
+	slots chan struct{}
+	// Signalled when a message is queued.
+	queued chan struct{}
+	// Closed when the Topic starts closing, after which no more messages
+	// will be queued.
+	closing chan struct{}
+	// Deliver queued messages after closing starts, rather than rejecting
+	// them. Set before closing is closed.
+	drain bool
+	// Held for reading while queueing a message, so that closing can wait
+	// for in-progress publishes.
+	closingLock sync.RWMutex
 	// Closed when the Topic is closed.
-	close chan struct{}
+	close     chan struct{}
+	closeOnce sync.Once
 }
 
 // New creates a new topic that can be used to publish and subscribe to messages.
-func New[T any]() *Topic[T] {
+func New[T any](options ...Option) *Topic[T] {
+	opts := newOptions(options)
 	s := &Topic[T]{
-		publish: make(chan Message[T], 16384),
-		control: make(chan control[T]),
-		close:   make(chan struct{}),
+		options:       opts,
+		control:       make(chan control[T]),
+		slots:         make(chan struct{}, opts.publishBuffer),
+		queued:        make(chan struct{}, 1),
+		subscriptions: map[chan Message[T]]subscribe[T]{},
+		groupCursors:  map[string]int{},
+		closing:       make(chan struct{}),
+		close:         make(chan struct{}),
+
+		publishInterceptors:  typedInterceptors[PublishInterceptor[T]]("publish", opts.publishInterceptors),
+		deliveryInterceptors: typedInterceptors[DeliveryInterceptor[T]]("delivery", opts.deliveryInterceptors),
 	}
 	go s.run()
 	return s
@@ -81,22 +162,155 @@ func (s *Topic[T]) Wait() chan struct{} {
 }
 
 // Publish a message to the topic.
-func (s *Topic[T]) Publish(t T) {
-	s.publish <- Message[T]{Msg: t, ack: make(chan error, 1)}
+//
+// If the publish queue is full, Publish will block until there is space, or
+// panic once the timeout set with WithPublishTimeout expires. Publish also
+// panics if the topic is closed.
+func (s *Topic[T]) Publish(t T, options ...PublishOption) {
+	var timeout <-chan time.Time
+	if s.options.publishTimeout > 0 {
+		timer := s.options.clock.NewTimer(s.options.publishTimeout)
+		defer timer.Stop()
+		timeout = timer.C()
+	}
+	err := s.enqueue(context.Background(), s.newMessage(t, options), timeout)
+	if errors.Is(err, errPublishTimeout) {
+		panic("publish timeout")
+	} else if err != nil {
+		panic(err)
+	}
 }
 
 // PublishSync publishes a message to the topic and blocks until all subscriber
 // channels have acked the message.
-func (s *Topic[T]) PublishSync(t T) error {
-	ack := make(chan error, 1)
-	s.publish <- Message[T]{Msg: t, ack: ack}
-	timer := time.NewTimer(AckTimeout)
+//
+// If a slow subscriber policy has been configured with WithSlowSubscriberPolicy
+// the topic guarantees a result for every message, so PublishSync will wait
+// for it rather than giving up after the ack timeout.
+//
+// Returns ErrClosed if the topic is closed.
+func (s *Topic[T]) PublishSync(t T, options ...PublishOption) error {
+	msg := s.newMessage(t, options)
+	msg.sync = true
+	ack := msg.ack
+	if err := s.enqueue(context.Background(), msg, nil); err != nil {
+		return err
+	}
+	if s.options.slowSubscriberPolicy != nil {
+		return <-ack
+	}
+	timer := s.options.clock.NewTimer(s.options.ackTimeout)
 	defer timer.Stop()
 	select {
 	case err := <-ack:
 		return err
-	case <-timer.C:
+	case <-timer.C():
+		return nil
+	}
+}
+
+// PublishContext publishes a message to the topic.
+//
+// If the publish queue is full it will block until there is space or the
+// context is done, in which case ctx.Err() is returned.
+//
+// Returns ErrClosed if the topic is closed.
+func (s *Topic[T]) PublishContext(ctx context.Context, t T, options ...PublishOption) error {
+	return s.enqueue(ctx, s.newMessage(t, options), nil)
+}
+
+// PublishSyncContext publishes a message to the topic and blocks until all
+// subscriber channels have acked the message or the context is done.
+//
+// Unlike PublishSync, there is no implicit timeout; if the context is done
+// before the message is acked ctx.Err() is returned.
+//
+// Returns ErrClosed if the topic is closed.
+func (s *Topic[T]) PublishSyncContext(ctx context.Context, t T, options ...PublishOption) error {
+	msg := s.newMessage(t, options)
+	msg.sync = true
+	ack := msg.ack
+	if err := s.enqueue(ctx, msg, nil); err != nil {
+		return err
+	}
+	select {
+	case err := <-ack:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Create a message to publish. The ack channel receives the result of
+// delivering it to all subscribers.
+func (s *Topic[T]) newMessage(t T, options []PublishOption) Message[T] {
+	opts := publishOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.id == "" {
+		opts.id = newMessageID()
+	}
+	return Message[T]{
+		Msg:      t,
+		ID:       opts.id,
+		Time:     s.options.clock.Now(),
+		Headers:  opts.headers,
+		ack:      make(chan error, 1),
+		priority: opts.priority,
+	}
+}
+
+func newMessageID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Returned by enqueue if the timeout fires.
+var errPublishTimeout = errors.New("publish timeout")
+
+// Queue a message for delivery, waiting until ctx is done or timeout fires
+// if the queue is full. A nil timeout never fires.
+func (s *Topic[T]) enqueue(ctx context.Context, msg Message[T], timeout <-chan time.Time) error {
+	s.closingLock.RLock()
+	defer s.closingLock.RUnlock()
+	select {
+	case <-s.closing:
+		return ErrClosed
+	default:
+	}
+	select {
+	case s.slots <- struct{}{}:
+		s.queue(msg)
+		return nil
+	case <-s.closing:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return errPublishTimeout
+	}
+}
+
+// Returned by tryEnqueue if the publish queue is full.
+var errQueueFull = errors.New("publish queue full")
+
+// Queue a message for delivery without blocking.
+func (s *Topic[T]) tryEnqueue(msg Message[T]) error {
+	s.closingLock.RLock()
+	defer s.closingLock.RUnlock()
+	select {
+	case <-s.closing:
+		return ErrClosed
+	default:
+	}
+	select {
+	case s.slots <- struct{}{}:
+		s.queue(msg)
 		return nil
+	default:
+		return errQueueFull
 	}
 }
 
@@ -109,22 +323,100 @@ func getSubscriber() string {
 //
 // The channel will be closed when the topic is closed.
 //
-// If "c" is nil a new channel of size 16 will be created.
-func (s *Topic[T]) Subscribe(c chan T) chan T {
+// If "c" is nil a new channel of the default subscriber buffer size will be
+// created.
+//
+// By default a full channel will block delivery to all subscribers, use
+// WithOverflow to change this.
+//
+// Subscribe panics with ErrClosed if the topic is closed. It is a thin
+// wrapper around Subscription.
+func (s *Topic[T]) Subscribe(c chan T, options ...SubscribeOption) chan T {
+	sub, err := s.subscribe(context.Background(), c, nil, options, getSubscriber())
+	if err != nil {
+		panic(err)
+	}
+	return sub.c
+}
+
+// SubscribeContext subscribes a channel to the topic.
+//
+// Unlike Subscribe, ErrClosed is returned if the topic is closed, and ctx.Err()
+// if the context is done before the subscription is registered.
+//
+// See Subscribe for details.
+func (s *Topic[T]) SubscribeContext(ctx context.Context, c chan T, options ...SubscribeOption) (chan T, error) {
+	sub, err := s.subscribe(ctx, c, nil, options, getSubscriber())
+	if err != nil {
+		return nil, err
+	}
+	return sub.c, nil
+}
+
+// Subscription subscribes a channel to the topic, returning a handle to the
+// subscription.
+//
+// See Subscribe for details.
+func (s *Topic[T]) Subscription(c chan T, options ...SubscribeOption) *Subscription[T] {
+	sub, err := s.subscribe(context.Background(), c, nil, options, getSubscriber())
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// SubscribeFunc subscribes a channel to the topic, receiving only messages
+// for which filter returns true.
+//
+// The filter is evaluated by the topic before delivery, so it must be fast
+// and must not call back into the topic.
+//
+// See Subscribe for details.
+func (s *Topic[T]) SubscribeFunc(c chan T, filter func(T) bool, options ...SubscribeOption) chan T {
+	sub, err := s.subscribe(context.Background(), c, filter, options, getSubscriber())
+	if err != nil {
+		panic(err)
+	}
+	return sub.c
+}
+
+func (s *Topic[T]) subscribe(ctx context.Context, c chan T, filter func(T) bool, options []SubscribeOption, subscriber string) (*Subscription[T], error) {
+	opts := newSubscribeOptions(options)
 	if c == nil {
-		c = make(chan T, 16)
-	}
-	forward := make(chan Message[T], cap(c))
-	go func() {
-		for msg := range forward {
-			c <- msg.Msg
-			msg.Ack()
-		}
-		close(c)
-	}()
-	s.rawChannelMap.Store(c, forward)
-	s.control <- subscribe[T]{msg: forward, subscriber: getSubscriber()}
-	return c
+		c = make(chan T, s.options.subscriberBuffer)
+	}
+	sub := &Subscription[T]{
+		topic: s,
+		c:     c,
+		fwd:   &forwarder[T]{forward: make(chan Message[T], cap(c))},
+	}
+	// Stored before subscribing so that closing the topic concurrently always
+	// removes it.
+	s.rawChannelMap.Store(c, sub)
+	err := s.sendControl(ctx, subscribe[T]{
+		msg:         sub.fwd.forward,
+		subscriber:  subscriber,
+		filter:      filter,
+		group:       opts.group,
+		replayAfter: opts.replayAfter,
+	})
+	if err != nil {
+		s.rawChannelMap.CompareAndDelete(c, sub)
+		return nil, err
+	}
+	// Started after subscribing so that "c" is left alone on error.
+	go sub.fwd.run(c, opts.overflow)
+	return sub, nil
+}
+
+// Dropped returns the number of messages dropped by the overflow policy of an
+// asynchronous subscription.
+func (s *Topic[T]) Dropped(c chan T) uint64 {
+	sub, ok := s.rawChannelMap.Load(c)
+	if !ok {
+		return 0
+	}
+	return sub.(*Subscription[T]).fwd.dropped.Load()
 }
 
 // SubscribeSync creates a synchronous subscription to the topic.
@@ -135,89 +427,446 @@ func (s *Topic[T]) Subscribe(c chan T) chan T {
 // all subscribers.
 //
 // The channel will be closed when the topic is closed.
-// If "c" is nil a new channel of size 16 will be created.
-func (s *Topic[T]) SubscribeSync(c chan Message[T]) chan Message[T] {
-	if c == nil {
-		c = make(chan Message[T], 16)
+// If "c" is nil a new channel of the default subscriber buffer size will be
+// created.
+//
+// Nacked messages can be redelivered with WithRedelivery and WithDeadLetter.
+//
+// SubscribeSync panics with ErrClosed if the topic is closed.
+func (s *Topic[T]) SubscribeSync(c chan Message[T], options ...SubscribeOption) chan Message[T] {
+	c, err := s.subscribeSync(context.Background(), c, nil, options, getSubscriber())
+	if err != nil {
+		panic(err)
 	}
-	s.control <- subscribe[T]{msg: c, subscriber: getSubscriber()}
 	return c
 }
 
+// SubscribeSyncContext creates a synchronous subscription to the topic.
+//
+// Unlike SubscribeSync, ErrClosed is returned if the topic is closed, and
+// ctx.Err() if the context is done before the subscription is registered.
+//
+// See SubscribeSync for details.
+func (s *Topic[T]) SubscribeSyncContext(ctx context.Context, c chan Message[T], options ...SubscribeOption) (chan Message[T], error) {
+	return s.subscribeSync(ctx, c, nil, options, getSubscriber())
+}
+
+// SubscribeSyncFunc creates a synchronous subscription to the topic, receiving
+// only messages for which filter returns true.
+//
+// Messages that do not match the filter are not delivered and do not need to
+// be acked.
+//
+// See SubscribeSync and SubscribeFunc for details.
+func (s *Topic[T]) SubscribeSyncFunc(c chan Message[T], filter func(T) bool, options ...SubscribeOption) chan Message[T] {
+	c, err := s.subscribeSync(context.Background(), c, filter, options, getSubscriber())
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func (s *Topic[T]) subscribeSync(ctx context.Context, c chan Message[T], filter func(T) bool, options []SubscribeOption, subscriber string) (chan Message[T], error) {
+	opts := newSubscribeOptions(options)
+	if c == nil {
+		c = make(chan Message[T], s.options.subscriberBuffer)
+	}
+	sub := subscribe[T]{
+		msg:         c,
+		subscriber:  subscriber,
+		filter:      filter,
+		group:       opts.group,
+		redelivery:  opts.redelivery,
+		replayAfter: opts.replayAfter,
+	}
+	if opts.deadLetter != nil {
+		deadLetter, ok := opts.deadLetter.(func(DeadLetter[T]) error)
+		if !ok {
+			panic(fmt.Sprintf("dead letter topic is not a *Topic[DeadLetter[%T]]", *new(T)))
+		}
+		sub.deadLetter = deadLetter
+	}
+	if err := s.sendControl(ctx, sub); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 // Unsubscribe a channel from the topic, closing the channel.
+//
+// Unlike Subscription.Close, this will panic if the channel is not
+// subscribed, including if the topic is closed.
 func (s *Topic[T]) Unsubscribe(c chan T) {
-	ackch, ok := s.rawChannelMap.Load(c)
+	sub, ok := s.rawChannelMap.Load(c)
 	if !ok { // This should never happen in practice.
 		panic("channel not subscribed")
 	}
-	s.rawChannelMap.Delete(c)
-	// Drain the subscription channel
-	go func() {
-		for range c {
+	_ = sub.(*Subscription[T]).Close()
+}
+
+// UnsubscribeContext unsubscribes a channel from the topic, closing the
+// channel.
+//
+// Unlike Unsubscribe, ErrClosed is returned if the topic is closed, and an
+// error if the channel is not subscribed.
+func (s *Topic[T]) UnsubscribeContext(ctx context.Context, c chan T) error {
+	sub, ok := s.rawChannelMap.Load(c)
+	if !ok {
+		select {
+		case <-s.closing:
+			return ErrClosed
+		default:
+			return errors.New("channel not subscribed")
 		}
-	}()
-	s.control <- unsubscribe[T](ackch.(chan Message[T]))
+	}
+	return sub.(*Subscription[T]).close(ctx)
 }
 
 // UnsubscribeSync a synchronised subscription from the topic, closing the channel.
+//
+// UnsubscribeSync panics with ErrClosed if the topic is closed.
 func (s *Topic[T]) UnsubscribeSync(c chan Message[T]) {
-	s.control <- unsubscribe[T](c)
+	if err := s.sendControl(context.Background(), unsubscribe[T](c)); err != nil {
+		panic(err)
+	}
+}
+
+// UnsubscribeSyncContext unsubscribes a synchronised subscription from the
+// topic, closing the channel.
+//
+// Unlike UnsubscribeSync, ErrClosed is returned if the topic is closed.
+func (s *Topic[T]) UnsubscribeSyncContext(ctx context.Context, c chan Message[T]) error {
+	return s.sendControl(ctx, unsubscribe[T](c))
+}
+
+// Send a control message to the run goroutine.
+func (s *Topic[T]) sendControl(ctx context.Context, msg control[T]) error {
+	select {
+	case <-s.close:
+		return ErrClosed
+	default:
+	}
+	select {
+	case s.control <- msg:
+		return nil
+	case <-s.close:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Close the topic, blocking until all subscribers have been closed.
+//
+// Messages that have been published but not yet delivered are discarded, and
+// synchronous publishers waiting on them receive ErrClosed. Use Shutdown to
+// deliver them first.
+//
+// It is safe to call Close more than once.
 func (s *Topic[T]) Close() error {
-	s.control <- stop{}
+	s.stop(false)
 	<-s.close
 	return nil
 }
 
+// Shutdown gracefully closes the topic.
+//
+// New publishes are rejected with ErrClosed, while messages that have
+// already been published are delivered to subscribers and acked before the
+// subscribers are closed.
+//
+// If ctx is done before shutdown completes ctx.Err() is returned, and the
+// topic will continue closing in the background.
+func (s *Topic[T]) Shutdown(ctx context.Context) error {
+	s.stop(true)
+	select {
+	case <-s.close:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Topic[T]) stop(drain bool) {
+	s.closeOnce.Do(func() {
+		s.drain = drain
+		close(s.closing)
+		// Wait for in-progress publishes, so that nothing is queued after
+		// the run goroutine stops.
+		s.closingLock.Lock()
+		s.closingLock.Unlock() //nolint:staticcheck
+		// The run goroutine may be busy delivering, so don't block callers
+		// that have a deadline.
+		go func() { s.control <- stop{} }()
+	})
+}
+
 func (s *Topic[T]) run() {
-	subscriptions := map[chan Message[T]]subscribe[T]{}
 	for {
+		// Control messages take precedence over a backlog, so that
+		// subscribing is not delayed by it.
 		select {
 		case msg := <-s.control:
-			switch msg := msg.(type) {
-			case subscribe[T]:
-				subscriptions[msg.msg] = msg
-
-			case unsubscribe[T]:
-				delete(subscriptions, msg)
-				close(msg)
-
-			case stop:
-				for ch := range subscriptions {
-					close(ch)
-				}
-				close(s.control)
-				close(s.publish)
-				s.rawChannelMap.Range(func(k, v any) bool {
-					s.rawChannelMap.Delete(k)
-					return true
-				})
-				close(s.close)
+			if s.handleControl(msg) {
 				return
-
-			default:
-				panic(fmt.Sprintf("unknown control message: %T", msg))
 			}
-
-		case msg := <-s.publish:
-			errs := []error{}
-			for ch, sub := range subscriptions {
-				smsg := Message[T]{Msg: msg.Msg, ack: make(chan error, 1)}
-				ch <- smsg
-				timer := time.NewTimer(AckTimeout)
-				select {
-				case err := <-smsg.ack:
-					errs = append(errs, err)
-				case <-timer.C:
-					// Print all goroutines
-					panic("ack timeout for " + sub.subscriber)
-				}
-				timer.Stop()
+			continue
+		default:
+		}
+		if msg, ok := s.dequeue(); ok {
+			s.dispatch(msg)
+			continue
+		}
+		select {
+		case msg := <-s.control:
+			if s.handleControl(msg) {
+				return
 			}
-			msg.ack <- errors.Join(errs...)
+
+		case <-s.queued:
+		}
+	}
+}
+
+// Handle a control message, returning true if the topic has stopped.
+func (s *Topic[T]) handleControl(msg control[T]) (stopped bool) {
+	switch msg := msg.(type) {
+	case subscribe[T]:
+		s.seq++
+		msg.seq = s.seq
+		msg.stats = newSubscriberStats(msg.subscriber, msg.group)
+		if msg.group != "" {
+			msg.stats.busy.Store(s.groupBusy(msg.group))
+		}
+		if drop := s.replay(msg); drop {
+			close(msg.msg)
+			break
+		}
+		s.lock.Lock()
+		s.subscriptions[msg.msg] = msg
+		s.lock.Unlock()
+
+	case unsubscribe[T]:
+		// The subscription may already have been dropped.
+		if _, ok := s.subscriptions[msg]; !ok {
+			break
+		}
+		s.removeSubscription(msg)
+
+	case stop:
+		s.flush()
+		for ch := range s.subscriptions {
+			s.removeSubscription(ch)
+		}
+		s.rawChannelMap.Range(func(k, v any) bool {
+			s.rawChannelMap.Delete(k)
+			return true
+		})
+		close(s.close)
+		return true
+
+	default:
+		panic(fmt.Sprintf("unknown control message: %T", msg))
+	}
+	return false
+}
+
+// Deliver a published message to all subscribers and send the result to the
+// publisher.
+//
+// Once the topic is closing the message is rejected with ErrClosed, unless
+// the topic is being drained.
+func (s *Topic[T]) dispatch(msg Message[T]) {
+	select {
+	case <-s.closing:
+		if !s.drain {
+			msg.ack <- ErrClosed
 			close(msg.ack)
+			return
 		}
+	default:
+	}
+	err := s.interceptPublish(msg, func(msg Message[T]) error {
+		errs := []error{}
+		for _, result := range s.fanOut(msg) {
+			errs = append(errs, result.err)
+			if result.drop {
+				s.removeSubscription(result.sub.msg)
+			}
+		}
+		s.retain(msg)
+		return errors.Join(errs...)
+	})
+	msg.ack <- err
+	close(msg.ack)
+}
+
+// Dispatch all queued messages.
+func (s *Topic[T]) flush() {
+	for {
+		msg, ok := s.dequeue()
+		if !ok {
+			return
+		}
+		s.dispatch(msg)
+	}
+}
+
+// Remove a subscription and close its channel.
+func (s *Topic[T]) removeSubscription(ch chan Message[T]) {
+	s.lock.Lock()
+	sub := s.subscriptions[ch]
+	delete(s.subscriptions, ch)
+	s.lock.Unlock()
+	close(ch)
+	if sub.group != "" {
+		s.forgetGroup(sub.group)
+	}
+}
+
+type deliveryResult[T any] struct {
+	sub  subscribe[T]
+	drop bool
+	err  error
+}
+
+// Deliver a message to all subscriptions, serially or in parallel, and wait for
+// every subscriber to ack it.
+//
+// Each consumer group receives the message once, as if it were a single
+// subscriber.
+//
+// As the next message is not delivered until this one has been acked by all
+// subscribers, per-subscriber ordering is preserved in both modes.
+func (s *Topic[T]) fanOut(msg Message[T]) []deliveryResult[T] {
+	tasks := []func() []deliveryResult[T]{}
+	groups := map[string][]subscribe[T]{}
+	for _, sub := range s.subscriptions {
+		if sub.filter != nil && !sub.filter(msg.Msg) {
+			continue
+		}
+		if sub.group != "" {
+			groups[sub.group] = append(groups[sub.group], sub)
+			continue
+		}
+		tasks = append(tasks, func() []deliveryResult[T] {
+			drop, err := s.deliver(sub, msg)
+			return []deliveryResult[T]{{sub: sub, drop: drop, err: err}}
+		})
+	}
+	for group, members := range groups {
+		// Balance in this goroutine, as it updates state owned by it.
+		members = s.balance(group, members)
+		tasks = append(tasks, func() []deliveryResult[T] { return s.deliverGroup(members, msg) })
+	}
+	results := make([][]deliveryResult[T], len(tasks))
+	if !s.options.parallelDelivery {
+		for i, task := range tasks {
+			results[i] = task()
+		}
+		return slices.Concat(results...)
+	}
+	wg := sync.WaitGroup{}
+	for i, task := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = task()
+		}()
+	}
+	wg.Wait()
+	return slices.Concat(results...)
+}
+
+// Deliver a message to a single subscriber and wait for it to be acked.
+//
+// Nacked messages are redelivered according to the subscriber's redelivery
+// policy, and sent to its dead letter topic if they are still nacked once
+// attempts are exhausted.
+func (s *Topic[T]) deliver(sub subscribe[T], msg Message[T]) (drop bool, err error) {
+	drop, timedOut, attempts, err := s.attempt(sub, msg)
+	if err != nil && !timedOut {
+		s.deadLetter(sub, msg, attempts, err)
+	}
+	return drop, err
+}
+
+// Deliver a message to a single subscriber, redelivering it according to the
+// subscriber's redelivery policy if it is nacked.
+//
+// Timed out messages are never redelivered.
+//
+// The attempt number of each delivery follows on from msg.Attempt.
+func (s *Topic[T]) attempt(sub subscribe[T], msg Message[T]) (drop, timedOut bool, attempts int, err error) {
+	for {
+		attempts++
+		delivery := msg
+		delivery.Attempt = msg.Attempt + attempts
+		drop, timedOut, err = s.interceptDelivery(sub, delivery)
+		if err == nil || timedOut || attempts >= sub.redelivery.maxAttempts() {
+			return drop, timedOut, attempts, err
+		}
+		sleep(s.options.clock, sub.redelivery.backoff(attempts))
+	}
+}
+
+func (s *Topic[T]) deadLetter(sub subscribe[T], msg Message[T], attempts int, err error) {
+	if sub.deadLetter == nil {
+		return
+	}
+	err = sub.deadLetter(DeadLetter[T]{
+		Msg:        msg.Msg,
+		ID:         msg.ID,
+		Headers:    msg.Headers,
+		Subscriber: sub.subscriber,
+		Attempts:   attempts,
+		Err:        err,
+	})
+	if err != nil {
+		sub.stats.deadLettersDropped.Add(1)
+	}
+}
+
+// Deliver a message to a single subscriber once.
+//
+// If the subscriber does not accept and ack the message within the ack timeout
+// the slow subscriber policy is applied.
+func (s *Topic[T]) deliverOnce(sub subscribe[T], msg Message[T]) (drop, timedOut bool, err error) {
+	smsg := msg
+	smsg.ack = make(chan error, 1)
+	timer := s.options.clock.NewTimer(s.options.ackTimeout)
+	defer timer.Stop()
+	select {
+	case sub.msg <- smsg:
+	case <-timer.C():
+		sub.stats.observeTimeout(s.options.ackTimeout)
+		drop, err = s.slowSubscriber(sub)
+		return drop, true, err
+	}
+	sub.stats.delivered.Add(1)
+	start := s.options.clock.Now()
+	select {
+	case err := <-smsg.ack:
+		sub.stats.observeAck(s.options.clock.Now().Sub(start), err)
+		return false, false, err
+	case <-timer.C():
+		sub.stats.observeTimeout(s.options.ackTimeout)
+		drop, err = s.slowSubscriber(sub)
+		return drop, true, err
+	}
+}
+
+func (s *Topic[T]) slowSubscriber(sub subscribe[T]) (drop bool, err error) {
+	action := SlowSubscriberPanic
+	if s.options.slowSubscriberPolicy != nil {
+		action = s.options.slowSubscriberPolicy(sub.subscriber)
+	}
+	switch action {
+	case SlowSubscriberDrop:
+		return true, fmt.Errorf("%w for %s", ErrAckTimeout, sub.subscriber)
+	case SlowSubscriberSkip:
+		return false, fmt.Errorf("%w for %s", ErrAckTimeout, sub.subscriber)
+	default:
+		panic("ack timeout for " + sub.subscriber)
 	}
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/alecthomas/assert/v2"
 	. "github.com/alecthomas/types/pubsub" //nolint
+	"github.com/alecthomas/types/pubsub/pubsubtest"
 )
 
 func Example() {
@@ -134,3 +135,1017 @@ func TestPubSubPanicAfterUnsubscribe(t *testing.T) {
 	}()
 	<-time.After(time.Minute)
 }
+
+func TestPublishSyncContext(t *testing.T) {
+	pubsub := New[string]()
+	defer pubsub.Close() //nolint
+	ch := pubsub.SubscribeSync(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := pubsub.PublishSyncContext(ctx, "hello")
+	assert.IsError(t, err, context.DeadlineExceeded)
+
+	// Late ack must not block the topic.
+	msg := <-ch
+	assert.Equal(t, "hello", msg.Msg)
+	msg.Ack()
+
+	go func() {
+		msg := <-ch
+		msg.Nack(errors.New("nack"))
+	}()
+	err = pubsub.PublishSyncContext(context.Background(), "world")
+	assert.EqualError(t, err, "nack")
+}
+
+func TestPublishContextFull(t *testing.T) {
+	pubsub := New[int](WithPublishBuffer(1))
+	defer pubsub.Close() //nolint
+	ch := pubsub.SubscribeSync(nil)
+
+	// Stall the topic on the first message, then fill the publish queue.
+	pubsub.Publish(0)
+	msg := <-ch
+	pubsub.Publish(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := pubsub.PublishContext(ctx, 2)
+	assert.IsError(t, err, context.DeadlineExceeded)
+
+	msg.Ack()
+	msg = <-ch
+	msg.Ack()
+}
+
+func TestPublishBlocks(t *testing.T) {
+	pubsub := New[int](WithPublishBuffer(1))
+	defer pubsub.Close() //nolint
+	ch := pubsub.SubscribeSync(nil)
+	pubsub.Publish(0)
+	msg := <-ch
+	pubsub.Publish(1)
+	published := make(chan struct{})
+	go func() {
+		pubsub.Publish(2)
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("publish should block while the queue is full")
+	case <-time.After(time.Millisecond * 50):
+	}
+	for range 2 {
+		msg.Ack()
+		msg = <-ch
+	}
+	<-published
+	msg.Ack()
+}
+
+func TestOptions(t *testing.T) {
+	pubsub := New[int](
+		WithDefaultSubscriberBuffer(4),
+		WithPublishBuffer(1),
+		WithPublishTimeout(time.Millisecond*50),
+	)
+	defer pubsub.Close() //nolint
+	assert.Equal(t, 4, cap(pubsub.Subscribe(nil)))
+	ch := pubsub.SubscribeSync(nil)
+	assert.Equal(t, 4, cap(ch))
+
+	pubsub.Publish(0)
+	msg := <-ch
+	pubsub.Publish(1)
+	assert.Panics(t, func() { pubsub.Publish(2) })
+
+	msg.Ack()
+	msg = <-ch
+	msg.Ack()
+}
+
+func TestSlowSubscriberSkip(t *testing.T) {
+	pubsub := New[string](WithAckTimeout(time.Millisecond*20), WithSlowSubscriberAction(SlowSubscriberSkip))
+	defer pubsub.Close() //nolint
+	ch := pubsub.SubscribeSync(nil)
+
+	err := pubsub.PublishSync("hello")
+	assert.IsError(t, err, ErrAckTimeout)
+	assert.Contains(t, err.Error(), "pubsub_test.go")
+	msg := <-ch
+	assert.Equal(t, "hello", msg.Msg)
+
+	// The subscriber should still receive messages.
+	go func() {
+		msg := <-ch
+		msg.Ack()
+	}()
+	err = pubsub.PublishSync("world")
+	assert.NoError(t, err)
+}
+
+func TestSlowSubscriberDrop(t *testing.T) {
+	pubsub := New[string](WithAckTimeout(time.Millisecond*20), WithSlowSubscriberAction(SlowSubscriberDrop))
+	defer pubsub.Close() //nolint
+	ch := pubsub.SubscribeSync(nil)
+
+	err := pubsub.PublishSync("hello")
+	assert.IsError(t, err, ErrAckTimeout)
+	msg, ok := <-ch
+	assert.True(t, ok)
+	assert.Equal(t, "hello", msg.Msg)
+	_, ok = <-ch
+	assert.False(t, ok, "channel should be closed")
+
+	// Unsubscribing a dropped subscriber is a no-op.
+	pubsub.UnsubscribeSync(ch)
+	assert.NoError(t, pubsub.PublishSync("world"))
+}
+
+func TestSlowSubscriberPolicy(t *testing.T) {
+	slow := make(chan string, 1)
+	pubsub := New[string](WithAckTimeout(time.Millisecond*20), WithSlowSubscriberPolicy(func(subscriber string) SlowSubscriberAction {
+		slow <- subscriber
+		return SlowSubscriberSkip
+	}))
+	defer pubsub.Close() //nolint
+	// Unbuffered and never received from.
+	pubsub.SubscribeSync(make(chan Message[string]))
+
+	err := pubsub.PublishSync("hello")
+	assert.IsError(t, err, ErrAckTimeout)
+	assert.Contains(t, <-slow, "TestSlowSubscriberPolicy")
+}
+
+func TestParallelDelivery(t *testing.T) {
+	pubsub := New[int](WithParallelDelivery())
+	defer pubsub.Close() //nolint
+
+	// Each subscriber only acks once both have received the message, which
+	// would deadlock with serial delivery.
+	const messages = 10
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	received := make(chan []int, 2)
+	for range 2 {
+		ch := pubsub.SubscribeSync(nil)
+		go func() {
+			actual := []int{}
+			for range messages {
+				msg := <-ch
+				actual = append(actual, msg.Msg)
+				arrived <- struct{}{}
+				<-release
+				msg.Nack(fmt.Errorf("%d", msg.Msg))
+			}
+			received <- actual
+		}()
+	}
+	go func() {
+		for range messages {
+			<-arrived
+			<-arrived
+			release <- struct{}{}
+			release <- struct{}{}
+		}
+	}()
+
+	for i := range messages {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := pubsub.PublishSyncContext(ctx, i)
+		cancel()
+		assert.EqualError(t, err, fmt.Sprintf("%d\n%d", i, i))
+	}
+	expected := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	assert.Equal(t, expected, <-received)
+	assert.Equal(t, expected, <-received)
+}
+
+func TestSubscribeOverflow(t *testing.T) {
+	tests := []struct {
+		policy   OverflowPolicy
+		expected []int
+		dropped  uint64
+	}{
+		{OverflowDropNewest, []int{0, 1}, 3},
+		{OverflowDropOldest, []int{3, 4}, 3},
+		{OverflowCoalesce, []int{4}, 4},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d", test.policy), func(t *testing.T) {
+			pubsub := New[int]()
+			defer pubsub.Close() //nolint
+			ch := pubsub.Subscribe(make(chan int, 2), WithOverflow(test.policy))
+			for i := range 5 {
+				assert.NoError(t, pubsub.PublishSync(i))
+			}
+			assert.Equal(t, test.dropped, pubsub.Dropped(ch))
+			actual := []int{}
+			for len(ch) > 0 {
+				actual = append(actual, <-ch)
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestSubscribeFunc(t *testing.T) {
+	pubsub := New[int]()
+	defer pubsub.Close() //nolint
+	even := func(i int) bool { return i%2 == 0 }
+	ch := pubsub.SubscribeFunc(make(chan int, 8), even)
+	acks := pubsub.SubscribeSyncFunc(nil, even)
+	go func() {
+		for msg := range acks {
+			msg.Nack(fmt.Errorf("%d", msg.Msg))
+		}
+	}()
+	for i := range 5 {
+		err := pubsub.PublishSync(i)
+		if even(i) {
+			assert.EqualError(t, err, fmt.Sprintf("%d", i))
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+	assert.Equal(t, []int{0, 2, 4}, []int{<-ch, <-ch, <-ch})
+}
+
+func TestMap(t *testing.T) {
+	source := New[int]()
+	derived := Map(source, func(i int) string { return fmt.Sprintf("<%d>", i) })
+	ch := derived.SubscribeSync(nil)
+	go func() {
+		for msg := range ch {
+			if msg.Msg == "<2>" {
+				msg.Nack(errors.New("two"))
+			} else {
+				msg.Ack()
+			}
+		}
+	}()
+	assert.NoError(t, source.PublishSync(1))
+	assert.EqualError(t, source.PublishSync(2), "two")
+
+	_ = source.Close()
+	select {
+	case <-derived.Wait():
+	case <-time.After(time.Second):
+		t.Fatal("derived topic should have been closed")
+	}
+}
+
+func TestMapCloseDerived(t *testing.T) {
+	source := New[int]()
+	defer source.Close() //nolint
+	derived := Map(source, func(i int) int { return i * 2 })
+	ch := derived.Subscribe(nil)
+	assert.NoError(t, source.PublishSync(1))
+	assert.Equal(t, 2, <-ch)
+
+	_ = derived.Close()
+	// Once unsubscribed the source no longer waits on the derived topic.
+	for range 10 {
+		assert.NoError(t, source.PublishSync(2))
+	}
+}
+
+func TestHandle(t *testing.T) {
+	pubsub := New[string]()
+	defer pubsub.Close() //nolint
+	received := []string{}
+	unsubscribe := pubsub.Handle(func(ctx context.Context, msg string) error {
+		received = append(received, msg)
+		switch msg {
+		case "error":
+			return errors.New("failed")
+		case "panic":
+			panic("boom")
+		default:
+			return nil
+		}
+	})
+	assert.NoError(t, pubsub.PublishSync("hello"))
+	assert.EqualError(t, pubsub.PublishSync("error"), "failed")
+	assert.EqualError(t, pubsub.PublishSync("panic"), "handler panicked: boom")
+
+	unsubscribe()
+	unsubscribe()
+	assert.NoError(t, pubsub.PublishSync("ignored"))
+	assert.Equal(t, []string{"hello", "error", "panic"}, received)
+}
+
+func TestHandleContextCancelledOnClose(t *testing.T) {
+	pubsub := New[string]()
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	unsubscribe := pubsub.Handle(func(ctx context.Context, msg string) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	go func() { _ = pubsub.PublishSync("hello") }()
+	<-started
+	go unsubscribe()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler context should have been cancelled")
+	}
+	_ = pubsub.Close()
+	unsubscribe()
+}
+
+func TestHandleUnsubscribeFromHandler(t *testing.T) {
+	pubsub := New[string]()
+	defer pubsub.Close() //nolint
+	received := []string{}
+	var unsubscribe func()
+	unsubscribe = pubsub.Handle(func(ctx context.Context, msg string) error {
+		received = append(received, msg)
+		go unsubscribe()
+		return nil
+	})
+	assert.NoError(t, pubsub.PublishSync("hello"))
+	for len(pubsub.Stats().Subscribers) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, pubsub.PublishSync("ignored"))
+	unsubscribe()
+	assert.Equal(t, []string{"hello"}, received)
+}
+
+func TestHandleUnsubscribeInFlight(t *testing.T) {
+	pubsub := New[string]()
+	defer pubsub.Close() //nolint
+	deadLetters := New[DeadLetter[string]]()
+	defer deadLetters.Close() //nolint
+	dead := deadLetters.Subscribe(nil)
+	started := make(chan struct{})
+	unsubscribe := pubsub.Handle(func(ctx context.Context, msg string) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithRedelivery(RedeliveryPolicy{MaxAttempts: 3}), WithDeadLetter(deadLetters))
+	result := make(chan error, 1)
+	go func() { result <- pubsub.PublishSync("hello") }()
+	<-started
+	unsubscribe()
+	assert.NoError(t, <-result)
+	pubsubtest.AssertNoMessage(t, dead, time.Millisecond*50)
+}
+
+func TestSubscription(t *testing.T) {
+	pubsub := New[int]()
+	defer pubsub.Close() //nolint
+	sub := pubsub.Subscription(make(chan int, 1), WithOverflow(OverflowDropNewest))
+	assert.NoError(t, pubsub.PublishSync(1))
+	assert.NoError(t, pubsub.PublishSync(2))
+	assert.Equal(t, SubscriptionStats{Delivered: 1, Dropped: 1}, sub.Stats())
+	assert.Equal(t, 1, <-sub.C())
+
+	assert.NoError(t, sub.Close())
+	assert.NoError(t, sub.Close())
+	select {
+	case _, ok := <-sub.C():
+		assert.False(t, ok, "channel should be closed")
+	case <-time.After(time.Second):
+		t.Fatal("channel should have been closed")
+	}
+	assert.NoError(t, pubsub.PublishSync(3))
+}
+
+func TestSubscriptionCloseAfterTopicClose(t *testing.T) {
+	pubsub := New[int]()
+	sub := pubsub.Subscription(nil)
+	_ = pubsub.Close()
+	assert.NoError(t, sub.Close())
+}
+
+func TestClosedErrors(t *testing.T) {
+	pubsub := New[int]()
+	ch := pubsub.Subscribe(nil)
+	syncCh := pubsub.SubscribeSync(nil)
+	assert.NoError(t, pubsub.Close())
+
+	ctx := context.Background()
+	assert.IsError(t, pubsub.UnsubscribeContext(ctx, ch), ErrClosed)
+	assert.IsError(t, pubsub.UnsubscribeSyncContext(ctx, syncCh), ErrClosed)
+	_, err := pubsub.SubscribeContext(ctx, nil)
+	assert.IsError(t, err, ErrClosed)
+	_, err = pubsub.SubscribeSyncContext(ctx, nil)
+	assert.IsError(t, err, ErrClosed)
+	assert.IsError(t, pubsub.PublishContext(ctx, 1), ErrClosed)
+	assert.IsError(t, pubsub.PublishSyncContext(ctx, 1), ErrClosed)
+
+	// Handlers and iterators on a closed topic are no-ops.
+	pubsub.Handle(func(context.Context, int) error { return nil })()
+	for range pubsub.All(ctx) {
+		t.Fatal("unexpected message")
+	}
+}
+
+func TestUnsubscribeContext(t *testing.T) {
+	pubsub := New[int]()
+	defer pubsub.Close() //nolint
+	ch, err := pubsub.SubscribeContext(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pubsub.UnsubscribeContext(context.Background(), ch))
+	_, ok := <-ch
+	assert.False(t, ok, "channel should be closed")
+	assert.EqualError(t, pubsub.UnsubscribeContext(context.Background(), ch), "channel not subscribed")
+}
+
+func TestSubscribeConcurrentClose(t *testing.T) {
+	for range 200 {
+		pubsub := New[int]()
+		ch := make(chan int)
+		subscribed := make(chan error, 1)
+		go func() {
+			_, err := pubsub.SubscribeContext(context.Background(), ch)
+			subscribed <- err
+		}()
+		assert.NoError(t, pubsub.Close())
+		<-subscribed
+		// Whether or not subscribing won the race, the channel is no longer
+		// subscribed.
+		assert.Panics(t, func() { pubsub.Unsubscribe(ch) })
+		assert.Equal(t, uint64(0), pubsub.Dropped(ch))
+	}
+
+	// Failing to subscribe does not register the channel.
+	pubsub := New[int]()
+	defer pubsub.Close() //nolint
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ch := make(chan int)
+	_, err := pubsub.SubscribeContext(ctx, ch)
+	assert.IsError(t, err, context.Canceled)
+	assert.EqualError(t, pubsub.UnsubscribeContext(context.Background(), ch), "channel not subscribed")
+}
+
+func TestShutdown(t *testing.T) {
+	pubsub := New[int]()
+	sub := pubsub.SubscribeSync(nil)
+	for i := range 3 {
+		pubsub.Publish(i)
+	}
+	// The first message is in flight, the rest are queued.
+	first := <-sub
+	// Start shutting down without waiting for it to complete.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.IsError(t, pubsub.Shutdown(ctx), context.Canceled)
+	assert.IsError(t, pubsub.PublishSync(3), ErrClosed)
+	assert.IsError(t, pubsub.PublishContext(context.Background(), 3), ErrClosed)
+	assert.Panics(t, func() { pubsub.Publish(3) })
+
+	first.Ack()
+	received := []int{first.Msg}
+	for msg := range sub {
+		received = append(received, msg.Msg)
+		msg.Ack()
+	}
+	assert.Equal(t, []int{0, 1, 2}, received)
+	assert.NoError(t, pubsub.Shutdown(context.Background()))
+}
+
+func TestShutdownContext(t *testing.T) {
+	pubsub := New[int]()
+	sub := pubsub.SubscribeSync(nil)
+	pubsub.Publish(1)
+	msg := <-sub
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.IsError(t, pubsub.Shutdown(ctx), context.DeadlineExceeded)
+	msg.Ack()
+	<-pubsub.Wait()
+}
+
+func TestCloseRejectsQueued(t *testing.T) {
+	pubsub := New[int]()
+	sub := pubsub.SubscribeSync(nil)
+	pubsub.Publish(1)
+	msg := <-sub
+	result := make(chan error, 1)
+	go func() { result <- pubsub.PublishSync(2) }()
+	// Wait for the second message to be queued.
+	for pubsub.Stats().QueueDepth == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	closed := make(chan struct{})
+	go func() {
+		_ = pubsub.Close()
+		close(closed)
+	}()
+	// Wait for the topic to start closing. Any messages queued in the
+	// meantime are rejected too.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for !errors.Is(pubsub.PublishContext(ctx, 0), ErrClosed) {
+		time.Sleep(time.Millisecond)
+	}
+	msg.Ack()
+	<-closed
+	assert.IsError(t, <-result, ErrClosed)
+	_, ok := <-sub
+	assert.False(t, ok, "subscription should be closed")
+}
+
+func TestRedelivery(t *testing.T) {
+	pubsub := New[string]()
+	defer pubsub.Close() //nolint
+	attempts := 0
+	unsubscribe := pubsub.Handle(func(ctx context.Context, msg string) error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf("attempt %d", attempts)
+		}
+		return nil
+	}, WithRedelivery(RedeliveryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+	defer unsubscribe()
+	assert.NoError(t, pubsub.PublishSync("hello"))
+	assert.Equal(t, 3, attempts)
+}
+
+func TestMessageMetadata(t *testing.T) {
+	pubsub := New[string](WithHistory(1))
+	defer pubsub.Close() //nolint
+	before := time.Now()
+	err := pubsub.PublishSync("hello", WithMessageID("id"), WithHeader("trace", "abc"))
+	assert.NoError(t, err)
+
+	// Metadata is preserved in the history.
+	replayed := pubsub.SubscribeSync(nil)
+	msg := <-replayed
+	msg.Ack()
+	assert.Equal(t, "id", msg.ID)
+	assert.Equal(t, map[string]string{"trace": "abc"}, msg.Headers)
+	assert.Equal(t, 1, msg.Attempt)
+	assert.False(t, msg.Time.Before(before))
+}
+
+func TestMessageAttempt(t *testing.T) {
+	pubsub := New[string]()
+	defer pubsub.Close() //nolint
+	ch := pubsub.SubscribeSync(nil, WithRedelivery(RedeliveryPolicy{MaxAttempts: 3}))
+	result := make(chan error, 1)
+	go func() { result <- pubsub.PublishSync("hello") }()
+	first := <-ch
+	first.Nack(nil)
+	second := <-ch
+	second.Ack()
+	assert.NoError(t, <-result)
+	assert.Equal(t, 1, first.Attempt)
+	assert.Equal(t, 2, second.Attempt)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, first.Time, second.Time)
+	assert.NotEqual(t, "", first.ID)
+
+	go func() { result <- pubsub.PublishSync("world") }()
+	third := <-ch
+	third.Ack()
+	assert.NoError(t, <-result)
+	assert.NotEqual(t, first.ID, third.ID)
+}
+
+func TestPublishInterceptor(t *testing.T) {
+	order := []string{}
+	pubsub := New[string](
+		WithPublishInterceptor(func(msg Message[string], next func(Message[string]) error) error {
+			order = append(order, "outer")
+			if msg.Msg == "invalid" {
+				return errors.New("rejected")
+			}
+			msg.Msg += "!"
+			return next(msg)
+		}),
+		WithPublishInterceptor(func(msg Message[string], next func(Message[string]) error) error {
+			order = append(order, "inner")
+			return fmt.Errorf("inner: %w", next(msg))
+		}),
+	)
+	defer pubsub.Close() //nolint
+	ch := pubsub.SubscribeSync(nil)
+	go func() {
+		msg := <-ch
+		msg.Nack(errors.New(msg.Msg))
+	}()
+	assert.EqualError(t, pubsub.PublishSync("hello"), "inner: hello!")
+	assert.EqualError(t, pubsub.PublishSync("invalid"), "rejected")
+	assert.Equal(t, []string{"outer", "inner", "outer"}, order)
+}
+
+func TestDeliveryInterceptor(t *testing.T) {
+	deliveries := make(chan string, 8)
+	pubsub := New[string](WithDeliveryInterceptor(func(subscriber string, msg Message[string], next func(Message[string]) error) error {
+		if msg.Msg == "invalid" {
+			return errors.New("rejected")
+		}
+		err := next(msg)
+		deliveries <- fmt.Sprintf("%s %d %v", msg.Msg, msg.Attempt, err)
+		return err
+	}))
+	defer pubsub.Close() //nolint
+	unsubscribe := pubsub.Handle(func(ctx context.Context, msg string) error {
+		if msg == "nack" {
+			return errors.New("nacked")
+		}
+		return nil
+	}, WithRedelivery(RedeliveryPolicy{MaxAttempts: 2}))
+	defer unsubscribe()
+	assert.NoError(t, pubsub.PublishSync("hello"))
+	assert.EqualError(t, pubsub.PublishSync("nack"), "nacked")
+	assert.EqualError(t, pubsub.PublishSync("invalid"), "rejected")
+	close(deliveries)
+	actual := []string{}
+	for delivery := range deliveries {
+		actual = append(actual, delivery)
+	}
+	assert.Equal(t, []string{"hello 1 <nil>", "nack 1 nacked", "nack 2 nacked"}, actual)
+}
+
+func TestInterceptorTypeMismatch(t *testing.T) {
+	assert.Panics(t, func() {
+		New[int](WithPublishInterceptor(func(msg Message[string], next func(Message[string]) error) error {
+			return next(msg)
+		}))
+	})
+}
+
+func TestDeadLetter(t *testing.T) {
+	pubsub := New[string]()
+	defer pubsub.Close() //nolint
+	dlq := New[DeadLetter[string]]()
+	defer dlq.Close() //nolint
+	deadLetters := dlq.Subscribe(nil)
+
+	attempts := 0
+	unsubscribe := pubsub.Handle(func(ctx context.Context, msg string) error {
+		attempts++
+		return fmt.Errorf("attempt %d", attempts)
+	}, WithRedelivery(RedeliveryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}), WithDeadLetter(dlq))
+	defer unsubscribe()
+	assert.EqualError(t, pubsub.PublishSync("hello"), "attempt 3")
+
+	select {
+	case dl := <-deadLetters:
+		assert.Equal(t, "hello", dl.Msg)
+		assert.Equal(t, 3, dl.Attempts)
+		assert.EqualError(t, dl.Err, "attempt 3")
+		assert.Contains(t, dl.Subscriber, "TestDeadLetter")
+	case <-time.After(time.Second):
+		t.Fatal("expected dead letter")
+	}
+}
+
+func TestDeadLetterClosed(t *testing.T) {
+	pubsub := New[string]()
+	defer pubsub.Close() //nolint
+	dlq := New[DeadLetter[string]]()
+	assert.NoError(t, dlq.Close())
+	unsubscribe := pubsub.Handle(func(ctx context.Context, msg string) error {
+		return errors.New("failed")
+	}, WithDeadLetter(dlq))
+	defer unsubscribe()
+	assert.EqualError(t, pubsub.PublishSync("hello"), "failed")
+	assert.Equal(t, uint64(1), pubsub.Stats().Subscribers[0].DeadLettersDropped)
+	// The topic is still usable.
+	assert.EqualError(t, pubsub.PublishSync("world"), "failed")
+}
+
+func TestDeadLetterTypeMismatch(t *testing.T) {
+	pubsub := New[int]()
+	defer pubsub.Close() //nolint
+	dlq := New[DeadLetter[string]]()
+	defer dlq.Close() //nolint
+	assert.Panics(t, func() { pubsub.SubscribeSync(nil, WithDeadLetter(dlq)) })
+}
+
+func TestPriority(t *testing.T) {
+	pubsub := New[string]()
+	defer pubsub.Close() //nolint
+	ch := pubsub.SubscribeSync(nil)
+	// Stall the topic on the first message, then queue the rest.
+	pubsub.Publish("first")
+	msg := <-ch
+	pubsub.Publish("low 1", WithPriority(PriorityLow))
+	pubsub.Publish("normal 1")
+	pubsub.Publish("high 1", WithPriority(PriorityHigh))
+	pubsub.Publish("low 2", WithPriority(PriorityLow))
+	pubsub.Publish("high 2", WithPriority(PriorityHigh))
+	pubsub.Publish("normal 2", WithPriority(PriorityNormal))
+	msg.Ack()
+
+	actual := []string{}
+	for range 6 {
+		msg := <-ch
+		actual = append(actual, msg.Msg)
+		msg.Ack()
+	}
+	assert.Equal(t, []string{"high 1", "high 2", "normal 1", "normal 2", "low 1", "low 2"}, actual)
+}
+
+func TestPrioritySaturated(t *testing.T) {
+	pubsub := New[string](WithPublishBuffer(4))
+	defer pubsub.Close() //nolint
+	ch := pubsub.SubscribeSync(nil)
+	full := func() {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		assert.IsError(t, pubsub.PublishContext(ctx, "normal"), context.DeadlineExceeded)
+	}
+	awaitDepth := func(depth int) {
+		t.Helper()
+		for pubsub.Stats().QueueDepth != depth {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	pubsub.Publish("first")
+	msg := <-ch
+	for i := range 4 {
+		pubsub.Publish(fmt.Sprintf("low %d", i+1), WithPriority(PriorityLow))
+	}
+	full()
+
+	// Delivering a message frees exactly one slot, shared by all priorities.
+	msg.Ack()
+	actual := []string{}
+	msg = <-ch
+	actual = append(actual, msg.Msg)
+	awaitDepth(3)
+	pubsub.Publish("low 5", WithPriority(PriorityLow))
+	full()
+
+	// Once there is space a high priority message skips the backlog.
+	go pubsub.Publish("high", WithPriority(PriorityHigh))
+	msg.Ack()
+	msg = <-ch
+	actual = append(actual, msg.Msg)
+	awaitDepth(4)
+	msg.Ack()
+	for range 4 {
+		msg := <-ch
+		actual = append(actual, msg.Msg)
+		msg.Ack()
+	}
+	assert.Equal(t, []string{"low 1", "low 2", "high", "low 3", "low 4", "low 5"}, actual)
+}
+
+func TestStats(t *testing.T) {
+	pubsub := New[int]()
+	defer pubsub.Close() //nolint
+	ch := pubsub.SubscribeSync(nil)
+
+	pubsub.Publish(1)
+	msg := <-ch
+	pubsub.Publish(2)
+	pubsub.Publish(3)
+	stats := pubsub.Stats()
+	assert.Equal(t, 2, stats.QueueDepth)
+	assert.Equal(t, 1, len(stats.Subscribers))
+	assert.Contains(t, stats.Subscribers[0].Subscriber, "TestStats")
+
+	msg.Ack()
+	msg = <-ch
+	msg.Nack(nil)
+	msg = <-ch
+	msg.Ack()
+	go func() {
+		msg := <-ch
+		msg.Ack()
+	}()
+	assert.NoError(t, pubsub.PublishSync(4)) // Wait for the topic to catch up.
+	stats = pubsub.Stats()
+	assert.Equal(t, 0, stats.QueueDepth)
+	sub := stats.Subscribers[0]
+	assert.Equal(t, uint64(4), sub.Delivered)
+	assert.Equal(t, uint64(3), sub.Acked)
+	assert.Equal(t, uint64(1), sub.Nacked)
+	assert.Equal(t, uint64(4), sub.AckLatency.Count)
+	assert.Equal(t, len(sub.AckLatency.Bounds)+1, len(sub.AckLatency.Counts))
+}
+
+func TestHistory(t *testing.T) {
+	pubsub := New[int](WithHistory(2))
+	defer pubsub.Close() //nolint
+	for i := range 3 {
+		assert.NoError(t, pubsub.PublishSync(i))
+	}
+	ch := pubsub.Subscribe(nil)
+	assert.NoError(t, pubsub.PublishSync(3))
+	assert.Equal(t, []int{1, 2, 3}, []int{<-ch, <-ch, <-ch})
+
+	odd := pubsub.SubscribeFunc(nil, func(i int) bool { return i%2 == 1 })
+	assert.NoError(t, pubsub.PublishSync(4))
+	assert.NoError(t, pubsub.PublishSync(5))
+	assert.Equal(t, []int{3, 5}, []int{<-odd, <-odd})
+}
+
+func TestReplayAfter(t *testing.T) {
+	pubsub := New[int](WithHistory(3))
+	defer pubsub.Close() //nolint
+	for i := range 4 {
+		assert.NoError(t, pubsub.PublishSync(i, WithMessageID(fmt.Sprint(i))))
+	}
+	ch := pubsub.Subscribe(nil, ReplayAfter("2"))
+	assert.NoError(t, pubsub.PublishSync(4))
+	assert.Equal(t, []int{3, 4}, []int{<-ch, <-ch})
+
+	// Expired from the history, so everything is replayed.
+	ch = pubsub.Subscribe(nil, ReplayAfter("0"))
+	assert.Equal(t, []int{2, 3, 4}, []int{<-ch, <-ch, <-ch})
+}
+
+func TestHistoryDuration(t *testing.T) {
+	pubsub := New[int](WithHistoryDuration(time.Millisecond * 50))
+	defer pubsub.Close() //nolint
+	assert.NoError(t, pubsub.PublishSync(1))
+	time.Sleep(time.Millisecond * 100)
+	assert.NoError(t, pubsub.PublishSync(2))
+	ch := pubsub.Subscribe(nil)
+	assert.NoError(t, pubsub.PublishSync(3))
+	assert.Equal(t, []int{2, 3}, []int{<-ch, <-ch})
+}
+
+func TestHistoryNoGaps(t *testing.T) {
+	const count = 1000
+	pubsub := New[int](WithHistory(count))
+	defer pubsub.Close() //nolint
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := range count {
+			pubsub.Publish(i)
+		}
+	}()
+	ch := pubsub.Subscribe(make(chan int, count+1))
+	<-published
+	assert.NoError(t, pubsub.PublishSync(count))
+	for i := range count + 1 {
+		assert.Equal(t, i, <-ch)
+	}
+}
+
+func TestConsumerGroup(t *testing.T) {
+	pubsub := New[int]()
+	defer pubsub.Close() //nolint
+	received := make([][]int, 3)
+	for i := range received {
+		unsubscribe := pubsub.Handle(func(ctx context.Context, msg int) error {
+			received[i] = append(received[i], msg)
+			return nil
+		}, InGroup("workers"))
+		defer unsubscribe()
+	}
+	all := pubsub.Subscribe(make(chan int, 8))
+	for i := range 6 {
+		assert.NoError(t, pubsub.PublishSync(i))
+	}
+	assert.Equal(t, [][]int{{0, 3}, {1, 4}, {2, 5}}, received)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, []int{<-all, <-all, <-all, <-all, <-all, <-all})
+
+	stats := pubsub.Stats()
+	assert.Equal(t, 4, len(stats.Subscribers))
+}
+
+func TestConsumerGroupReassign(t *testing.T) {
+	pubsub := New[int]()
+	defer pubsub.Close() //nolint
+	received := []int{}
+	unsubscribe := pubsub.Handle(func(ctx context.Context, msg int) error {
+		return fmt.Errorf("failed %d", msg)
+	}, InGroup("workers"))
+	defer unsubscribe()
+	unsubscribe = pubsub.Handle(func(ctx context.Context, msg int) error {
+		received = append(received, msg)
+		if msg == 2 {
+			return errors.New("failed 2 again")
+		}
+		return nil
+	}, InGroup("workers"))
+	defer unsubscribe()
+
+	assert.NoError(t, pubsub.PublishSync(0))
+	assert.NoError(t, pubsub.PublishSync(1))
+	assert.EqualError(t, pubsub.PublishSync(2), "failed 2\nfailed 2 again")
+	assert.Equal(t, []int{0, 1, 2}, received)
+}
+
+func TestConsumerGroupLeastLoaded(t *testing.T) {
+	pubsub := New[int](WithGroupBalancing(BalanceLeastLoaded), WithParallelDelivery())
+	defer pubsub.Close() //nolint
+	slow, fast := 0, 0
+	unsubscribe := pubsub.Handle(func(ctx context.Context, msg int) error {
+		slow++
+		time.Sleep(time.Millisecond * 20)
+		return nil
+	}, InGroup("workers"))
+	defer unsubscribe()
+	unsubscribe = pubsub.Handle(func(ctx context.Context, msg int) error {
+		fast++
+		return nil
+	}, InGroup("workers"))
+	defer unsubscribe()
+	for i := range 11 {
+		assert.NoError(t, pubsub.PublishSync(i))
+	}
+	assert.Equal(t, 11, slow+fast)
+	assert.True(t, slow < fast, "slow=%d fast=%d", slow, fast)
+}
+
+func TestAll(t *testing.T) {
+	pubsub := New[int](WithHistory(3))
+	defer pubsub.Close() //nolint
+	for i := range 3 {
+		pubsub.Publish(i)
+	}
+	actual := []int{}
+	for msg := range pubsub.All(context.Background()) {
+		actual = append(actual, msg)
+		if msg == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []int{0, 1, 2}, actual)
+	// The iterator should have unsubscribed.
+	assert.NoError(t, pubsub.PublishSync(3))
+	assert.Equal(t, 0, len(pubsub.Stats().Subscribers))
+}
+
+func TestAllContext(t *testing.T) {
+	pubsub := New[int]()
+	defer pubsub.Close() //nolint
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	for range pubsub.All(ctx) {
+		t.Fatal("unexpected message")
+	}
+	assert.IsError(t, ctx.Err(), context.DeadlineExceeded)
+}
+
+func TestAllSync(t *testing.T) {
+	pubsub := New[int](WithHistory(3))
+	defer pubsub.Close() //nolint
+	for i := range 3 {
+		pubsub.Publish(i)
+	}
+	subscribed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg, ack := range pubsub.AllSync(context.Background()) {
+			switch msg {
+			case 0:
+				// Replayed from history, so the subscription is live.
+				close(subscribed)
+			case 3:
+				ack(errors.New("three"))
+			case 4:
+				// Acked automatically.
+			case 5:
+				return
+			}
+		}
+	}()
+	<-subscribed
+	assert.EqualError(t, pubsub.PublishSync(3), "three")
+	assert.NoError(t, pubsub.PublishSync(4))
+	assert.NoError(t, pubsub.PublishSync(5))
+	<-done
+	assert.NoError(t, pubsub.PublishSync(6))
+}
+
+func TestAllSyncUnsubscribeInFlight(t *testing.T) {
+	pubsub := New[int]()
+	defer pubsub.Close() //nolint
+	deadLetters := New[DeadLetter[int]]()
+	defer deadLetters.Close() //nolint
+	dead := deadLetters.Subscribe(nil)
+	received := make(chan struct{})
+	result := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, ack := range pubsub.AllSync(context.Background(),
+			WithRedelivery(RedeliveryPolicy{MaxAttempts: 3}), WithDeadLetter(deadLetters)) {
+			close(received)
+			ack(nil)
+			// Publish another message, which is in flight as we exit.
+			go func() { result <- pubsub.PublishSync(1) }()
+			time.Sleep(time.Millisecond * 10)
+			return
+		}
+	}()
+	for len(pubsub.Stats().Subscribers) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	pubsub.Publish(0)
+	<-received
+	<-done
+	assert.NoError(t, <-result)
+	pubsubtest.AssertNoMessage(t, dead, time.Millisecond*50)
+}
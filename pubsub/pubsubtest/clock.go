@@ -0,0 +1,139 @@
+package pubsubtest
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/types/pubsub"
+)
+
+// Clock is a pubsub.Clock that only advances when told to, for use with
+// pubsub.WithClock.
+//
+// Timers fire when the clock is advanced past their deadline. As topics create
+// timers from their own goroutines, use BlockUntilTimer to wait for a timer
+// to be created before advancing the clock.
+type Clock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*timer
+	// Closed and replaced when the set of active timers changes.
+	changed chan struct{}
+}
+
+var _ pubsub.Clock = (*Clock)(nil)
+
+// NewClock creates a Clock set to "now".
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now, changed: make(chan struct{})}
+}
+
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *Clock) NewTimer(d time.Duration) pubsub.Timer {
+	t := &timer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advance the clock by d, firing any timers whose deadline is reached.
+func (c *Clock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	c.fire()
+}
+
+// BlockUntilTimer blocks until there is an active timer that will fire if the
+// clock is advanced by d.
+//
+// For example, after publishing to a topic with an ack timeout of one minute,
+// BlockUntilTimer(time.Minute) waits for the message to be delivered.
+func (c *Clock) BlockUntilTimer(d time.Duration) {
+	for {
+		c.lock.Lock()
+		deadline, changed := c.now.Add(d), c.changed
+		due := slices.ContainsFunc(c.timers, func(t *timer) bool { return !t.deadline.After(deadline) })
+		c.lock.Unlock()
+		if due {
+			return
+		}
+		<-changed
+	}
+}
+
+// Fire due timers. Must be called with the lock held.
+func (c *Clock) fire() {
+	remaining := c.timers[:0]
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			remaining = append(remaining, t)
+			continue
+		}
+		select {
+		case t.c <- c.now:
+		default:
+		}
+	}
+	clear(c.timers[len(remaining):])
+	c.timers = remaining
+	c.notify()
+}
+
+// Must be called with the lock held.
+func (c *Clock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Remove t from the active timers, returning true if it was active. Must be
+// called with the lock held.
+func (c *Clock) remove(t *timer) bool {
+	i := slices.Index(c.timers, t)
+	if i < 0 {
+		return false
+	}
+	c.timers = slices.Delete(c.timers, i, i+1)
+	c.notify()
+	return true
+}
+
+type timer struct {
+	clock    *Clock
+	c        chan time.Time
+	deadline time.Time
+}
+
+func (t *timer) C() <-chan time.Time { return t.c }
+
+func (t *timer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	t.drain()
+	return t.clock.remove(t)
+}
+
+func (t *timer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	active := c.remove(t)
+	t.drain()
+	t.deadline = c.now.Add(d)
+	c.timers = append(c.timers, t)
+	c.fire()
+	return active
+}
+
+// As with time.Timer, a stopped or reset timer does not deliver a stale value.
+func (t *timer) drain() {
+	select {
+	case <-t.c:
+	default:
+	}
+}
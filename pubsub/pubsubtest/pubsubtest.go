@@ -0,0 +1,159 @@
+// Package pubsubtest provides helpers for testing code that uses pubsub.
+//
+// Clock makes ack and publish timeouts, redelivery backoff and combinator
+// timers deterministic, while Recorder, AwaitMessages and AssertNoMessage
+// replace ad-hoc sleeps when waiting for messages.
+package pubsubtest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/types/pubsub"
+)
+
+// AwaitMessages receives "n" messages from sub, failing the test if they are
+// not received within timeout or sub is closed.
+func AwaitMessages[T any](t testing.TB, sub <-chan T, n int, timeout time.Duration) []T {
+	t.Helper()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	msgs := make([]T, 0, n)
+	for len(msgs) < n {
+		select {
+		case msg, ok := <-sub:
+			if !ok {
+				t.Fatalf("subscription closed after %d of %d messages", len(msgs), n)
+			}
+			msgs = append(msgs, msg)
+		case <-deadline.C:
+			t.Fatalf("timed out after %s waiting for %d messages, received %d", timeout, n, len(msgs))
+		}
+	}
+	return msgs
+}
+
+// AssertNoMessage fails the test if a message is received from sub within
+// "wait".
+//
+// A closed subscription is not considered a message.
+func AssertNoMessage[T any](t testing.TB, sub <-chan T, wait time.Duration) {
+	t.Helper()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case msg, ok := <-sub:
+		if ok {
+			t.Fatalf("unexpected message: %v", msg)
+		}
+	case <-timer.C:
+	}
+}
+
+// Recorder is a synchronous subscriber that records every message delivered
+// to it.
+type Recorder[T any] struct {
+	topic  *pubsub.Topic[T]
+	ch     chan pubsub.Message[T]
+	done   chan struct{}
+	lock   sync.Mutex
+	msgs   []pubsub.Message[T]
+	signal chan struct{}
+}
+
+// Record subscribes a Recorder to topic that acks every message.
+func Record[T any](topic *pubsub.Topic[T], options ...pubsub.SubscribeOption) *Recorder[T] {
+	return RecordFunc(topic, nil, options...)
+}
+
+// RecordFunc subscribes a Recorder to topic that acks each message if handle
+// returns nil, or nacks it with the returned error.
+//
+// A nil handle acks every message.
+func RecordFunc[T any](topic *pubsub.Topic[T], handle func(pubsub.Message[T]) error, options ...pubsub.SubscribeOption) *Recorder[T] {
+	r := &Recorder[T]{
+		topic:  topic,
+		ch:     topic.SubscribeSync(nil, options...),
+		done:   make(chan struct{}),
+		signal: make(chan struct{}),
+	}
+	go func() {
+		defer close(r.done)
+		for msg := range r.ch {
+			r.lock.Lock()
+			r.msgs = append(r.msgs, msg)
+			close(r.signal)
+			r.signal = make(chan struct{})
+			r.lock.Unlock()
+			var err error
+			if handle != nil {
+				err = handle(msg)
+			}
+			if err != nil {
+				msg.Nack(err)
+			} else {
+				msg.Ack()
+			}
+		}
+	}()
+	return r
+}
+
+// Messages returns the messages recorded so far, including their metadata.
+func (r *Recorder[T]) Messages() []pubsub.Message[T] {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]pubsub.Message[T](nil), r.msgs...)
+}
+
+// Values returns the values of the messages recorded so far.
+func (r *Recorder[T]) Values() []T {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	values := make([]T, len(r.msgs))
+	for i, msg := range r.msgs {
+		values[i] = msg.Msg
+	}
+	return values
+}
+
+// Await waits until at least "n" messages have been recorded, returning the
+// values of the first n. It fails the test if they are not recorded within
+// timeout.
+func (r *Recorder[T]) Await(t testing.TB, n int, timeout time.Duration) []T {
+	t.Helper()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		r.lock.Lock()
+		recorded, signal := len(r.msgs), r.signal
+		r.lock.Unlock()
+		if recorded >= n {
+			return r.Values()[:n]
+		}
+		select {
+		case <-signal:
+		case <-r.done:
+			if recorded = len(r.Messages()); recorded < n {
+				t.Fatalf("subscription closed after %d of %d messages", recorded, n)
+			}
+		case <-deadline.C:
+			t.Fatalf("timed out after %s waiting for %d messages, recorded %d", timeout, n, recorded)
+		}
+	}
+}
+
+// Close unsubscribes the Recorder from the topic.
+//
+// It is safe to call Close after the topic is closed.
+func (r *Recorder[T]) Close() {
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	_ = r.topic.UnsubscribeSyncContext(context.Background(), r.ch)
+	<-r.done
+}
@@ -0,0 +1,81 @@
+package pubsubtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/alecthomas/types/pubsub"
+	. "github.com/alecthomas/types/pubsub/pubsubtest"
+)
+
+func TestAwaitMessages(t *testing.T) {
+	topic := pubsub.New[int]()
+	defer topic.Close() //nolint
+	sub := topic.Subscribe(nil)
+	AssertNoMessage(t, sub, time.Millisecond*10)
+	topic.Publish(1)
+	topic.Publish(2)
+	assert.Equal(t, []int{1, 2}, AwaitMessages(t, sub, 2, time.Second))
+	AssertNoMessage(t, sub, time.Millisecond*10)
+}
+
+func TestRecorder(t *testing.T) {
+	topic := pubsub.New[string]()
+	defer topic.Close() //nolint
+	recorder := RecordFunc(topic, func(msg pubsub.Message[string]) error {
+		if msg.Msg == "invalid" {
+			return errors.New("invalid message")
+		}
+		return nil
+	})
+	defer recorder.Close()
+	assert.NoError(t, topic.PublishSync("hello", pubsub.WithHeader("Key", "value")))
+	assert.EqualError(t, topic.PublishSync("invalid"), "invalid message")
+	assert.Equal(t, []string{"hello", "invalid"}, recorder.Await(t, 2, time.Second))
+	assert.Equal(t, "value", recorder.Messages()[0].Headers["Key"])
+}
+
+func TestClockAckTimeout(t *testing.T) {
+	clock := NewClock(time.Now())
+	topic := pubsub.New[string](
+		pubsub.WithClock(clock),
+		pubsub.WithAckTimeout(time.Minute),
+		pubsub.WithSlowSubscriberAction(pubsub.SlowSubscriberSkip),
+	)
+	defer topic.Close() //nolint
+	ch := topic.SubscribeSync(nil)
+	result := make(chan error, 1)
+	go func() { result <- topic.PublishSync("hello") }()
+	msg := <-ch
+	clock.BlockUntilTimer(time.Minute)
+	AssertNoMessage(t, result, time.Millisecond*10)
+	clock.Advance(time.Minute)
+	assert.IsError(t, <-result, pubsub.ErrAckTimeout)
+	msg.Ack()
+}
+
+func TestClockRedelivery(t *testing.T) {
+	clock := NewClock(time.Now())
+	topic := pubsub.New[string](pubsub.WithClock(clock), pubsub.WithAckTimeout(time.Hour))
+	defer topic.Close() //nolint
+	recorder := RecordFunc(topic, func(msg pubsub.Message[string]) error {
+		if msg.Attempt == 1 {
+			return errors.New("try again")
+		}
+		return nil
+	}, pubsub.WithRedelivery(pubsub.RedeliveryPolicy{MaxAttempts: 2, Backoff: time.Minute}))
+	defer recorder.Close()
+	assert.NoError(t, topic.PublishContext(context.Background(), "hello"))
+	recorder.Await(t, 1, time.Second)
+	clock.BlockUntilTimer(time.Minute)
+	assert.Equal(t, 1, len(recorder.Messages()))
+	clock.Advance(time.Minute)
+	recorder.Await(t, 2, time.Second)
+	msgs := recorder.Messages()
+	assert.Equal(t, 2, msgs[1].Attempt)
+	assert.Equal(t, msgs[0].ID, msgs[1].ID)
+}
@@ -0,0 +1,55 @@
+package pubsub
+
+import "time"
+
+// RedeliveryPolicy controls how messages nacked by a synchronous subscriber
+// are redelivered.
+//
+// The zero value disables redelivery.
+type RedeliveryPolicy struct {
+	// MaxAttempts is the maximum number of times a message is delivered,
+	// including the first delivery.
+	MaxAttempts int
+	// Backoff is the delay before the first redelivery.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+	// Multiplier is applied to the delay after each redelivery. Values less
+	// than 1 are treated as 2.
+	Multiplier float64
+}
+
+func (r RedeliveryPolicy) maxAttempts() int {
+	return max(r.MaxAttempts, 1)
+}
+
+// The delay before redelivering a message that has been delivered "attempts" times.
+func (r RedeliveryPolicy) backoff(attempts int) time.Duration {
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(r.Backoff)
+	for range attempts - 1 {
+		delay *= multiplier
+		if r.MaxBackoff > 0 && delay >= float64(r.MaxBackoff) {
+			return r.MaxBackoff
+		}
+	}
+	return time.Duration(delay)
+}
+
+// DeadLetter is a message that was still nacked by a subscriber after all
+// redelivery attempts were exhausted.
+type DeadLetter[T any] struct {
+	Msg T
+	// ID and Headers of the original message.
+	ID      string
+	Headers map[string]string
+	// Subscriber is the identity of the subscriber that nacked the message.
+	Subscriber string
+	// Attempts is the number of times the message was delivered.
+	Attempts int
+	// Err is the final nack error.
+	Err error
+}
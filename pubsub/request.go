@@ -0,0 +1,103 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNoReply is returned by Call when every subscriber acked a request
+// without replying.
+var ErrNoReply = errors.New("no reply")
+
+// Request is a message published by Call or Gather that subscribers can reply
+// to.
+//
+// Subscribers should reply before acking the request.
+type Request[Req, Resp any] struct {
+	Msg     Req
+	replies *replies[Resp]
+}
+
+// Reply to the request.
+//
+// Replies received after the requester has stopped waiting are discarded.
+func (r Request[Req, Resp]) Reply(resp Resp) {
+	r.replies.add(resp)
+}
+
+// Call publishes a request to topic and returns the first reply.
+//
+// If every subscriber acks the request without replying, the nack errors, if
+// any, are joined with ErrNoReply. If ctx is done before a reply is received
+// ctx.Err() is returned.
+func Call[Req, Resp any](ctx context.Context, topic *Topic[Request[Req, Resp]], req Req) (Resp, error) {
+	var zero Resp
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	replies := &replies[Resp]{received: make(chan struct{})}
+	defer replies.close()
+	published := make(chan error, 1)
+	go func() { published <- topic.PublishSyncContext(ctx, Request[Req, Resp]{Msg: req, replies: replies}) }()
+	select {
+	case <-replies.received:
+		return replies.take()[0], nil
+
+	case err := <-published:
+		// A reply may have raced with the final ack.
+		if values := replies.take(); len(values) > 0 {
+			return values[0], nil
+		}
+		if ctx.Err() != nil {
+			return zero, ctx.Err()
+		}
+		return zero, errors.Join(err, ErrNoReply)
+
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// Gather publishes a request to topic and returns all replies once every
+// subscriber has acked it.
+//
+// Nack errors are joined and returned along with any replies. If ctx is done
+// first, the replies received so far are returned along with ctx.Err().
+func Gather[Req, Resp any](ctx context.Context, topic *Topic[Request[Req, Resp]], req Req) ([]Resp, error) {
+	replies := &replies[Resp]{received: make(chan struct{})}
+	defer replies.close()
+	err := topic.PublishSyncContext(ctx, Request[Req, Resp]{Msg: req, replies: replies})
+	return replies.take(), err
+}
+
+type replies[Resp any] struct {
+	lock   sync.Mutex
+	values []Resp
+	closed bool
+	// Closed when the first reply is received.
+	received chan struct{}
+}
+
+func (r *replies[Resp]) add(resp Resp) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return
+	}
+	r.values = append(r.values, resp)
+	if len(r.values) == 1 {
+		close(r.received)
+	}
+}
+
+func (r *replies[Resp]) take() []Resp {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.values
+}
+
+func (r *replies[Resp]) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.closed = true
+}
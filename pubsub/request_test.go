@@ -0,0 +1,77 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	. "github.com/alecthomas/types/pubsub" //nolint
+)
+
+func TestCall(t *testing.T) {
+	topic := New[Request[int, string]]()
+	defer topic.Close() //nolint
+	unsubscribe := topic.Handle(func(ctx context.Context, req Request[int, string]) error {
+		req.Reply(fmt.Sprintf("reply %d", req.Msg))
+		return nil
+	})
+	defer unsubscribe()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := Call(ctx, topic, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "reply 1", resp)
+}
+
+func TestCallNoReply(t *testing.T) {
+	topic := New[Request[int, string]]()
+	defer topic.Close() //nolint
+	unsubscribe := topic.Handle(func(ctx context.Context, req Request[int, string]) error {
+		return errors.New("unavailable")
+	})
+	defer unsubscribe()
+
+	_, err := Call(context.Background(), topic, 1)
+	assert.IsError(t, err, ErrNoReply)
+	assert.Contains(t, err.Error(), "unavailable")
+}
+
+func TestCallTimeout(t *testing.T) {
+	topic := New[Request[int, string]]()
+	defer topic.Close() //nolint
+	release := make(chan struct{})
+	unsubscribe := topic.Handle(func(ctx context.Context, req Request[int, string]) error {
+		<-release
+		req.Reply("too late")
+		return nil
+	})
+	defer unsubscribe()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err := Call(ctx, topic, 1)
+	assert.IsError(t, err, context.DeadlineExceeded)
+}
+
+func TestGather(t *testing.T) {
+	topic := New[Request[int, int]](WithParallelDelivery())
+	defer topic.Close() //nolint
+	for i := range 3 {
+		unsubscribe := topic.Handle(func(ctx context.Context, req Request[int, int]) error {
+			req.Reply(req.Msg * (i + 1))
+			return nil
+		})
+		defer unsubscribe()
+	}
+
+	replies, err := Gather(context.Background(), topic, 10)
+	assert.NoError(t, err)
+	sort.Ints(replies)
+	assert.Equal(t, []int{10, 20, 30}, replies)
+}
@@ -0,0 +1,413 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Default publish buffer of topics created by a Router, which is much
+	// smaller than that of a standalone Topic as a Router may create many.
+	routePublishBuffer = 256
+	// How long a topic must go without publishes before it is closed, even if
+	// it has subscribers.
+	routeIdleTimeout = time.Minute
+)
+
+// ErrInvalidTopicName is returned when a topic name or subscription pattern is
+// malformed.
+var ErrInvalidTopicName = errors.New("invalid topic name")
+
+// Routed is a message received from a Router, along with the name of the
+// topic it was published to.
+type Routed[T any] struct {
+	Topic string
+	Msg   T
+}
+
+// Router manages a set of Topics identified by hierarchical names.
+//
+// Names are dot-separated tokens, such as "orders.eu.created". Subscription
+// patterns may additionally use "*" to match exactly one token, such as
+// "orders.*.created", or a trailing ">" to match one or more tokens, such as
+// "orders.>".
+//
+// Topics are created when a message is published to a name that has matching
+// subscribers, and closed once they have no subscribers or have not been
+// published to for a minute. Messages published to a name without subscribers
+// are discarded.
+type Router[T any] struct {
+	options       []Option
+	clock         Clock
+	lock          sync.Mutex
+	routes        map[string]*route[T]
+	subscriptions map[*RouterSubscription[T]]struct{}
+	closed        bool
+}
+
+type route[T any] struct {
+	name          string
+	topic         *Topic[T]
+	subscriptions int
+	publishers    int
+	// Time of the last publish to the route.
+	lastUsed time.Time
+}
+
+// NewRouter creates a new Router.
+//
+// Options are applied to every Topic created by the Router. Unless overridden
+// with WithPublishBuffer, topics have a publish buffer of 256.
+func NewRouter[T any](options ...Option) *Router[T] {
+	options = append([]Option{WithPublishBuffer(routePublishBuffer)}, options...)
+	return &Router[T]{
+		options:       options,
+		clock:         newOptions(options).clock,
+		routes:        map[string]*route[T]{},
+		subscriptions: map[*RouterSubscription[T]]struct{}{},
+	}
+}
+
+// Publish a message to the named topic.
+func (r *Router[T]) Publish(name string, msg T) error {
+	return r.publish(name, func(topic *Topic[T]) error {
+		topic.Publish(msg)
+		return nil
+	})
+}
+
+// PublishSync publishes a message to the named topic and blocks until all
+// subscribers have received it, or the context is done.
+func (r *Router[T]) PublishSync(ctx context.Context, name string, msg T) error {
+	return r.publish(name, func(topic *Topic[T]) error {
+		return topic.PublishSyncContext(ctx, msg)
+	})
+}
+
+func (r *Router[T]) publish(name string, publish func(topic *Topic[T]) error) error {
+	if err := validateTopicName(name, false); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return ErrClosed
+	}
+	rt := r.route(name)
+	if rt == nil {
+		r.lock.Unlock()
+		return nil
+	}
+	rt.publishers++
+	r.lock.Unlock()
+
+	err := publish(rt.topic)
+
+	r.lock.Lock()
+	rt.publishers--
+	rt.lastUsed = r.clock.Now()
+	collect := r.collect(rt)
+	r.lock.Unlock()
+	if collect {
+		_ = rt.topic.Close()
+	}
+	return err
+}
+
+// Get or create the route for name, returning nil if there are no matching
+// subscribers.
+//
+// Must be called with the lock held.
+func (r *Router[T]) route(name string) *route[T] {
+	if rt, ok := r.routes[name]; ok {
+		return rt
+	}
+	var matching []*RouterSubscription[T]
+	for sub := range r.subscriptions {
+		if matchTopicName(sub.pattern, name) {
+			matching = append(matching, sub)
+		}
+	}
+	if len(matching) == 0 {
+		return nil
+	}
+	rt := &route[T]{name: name, topic: New[T](r.options...), lastUsed: r.clock.Now()}
+	r.routes[name] = rt
+	for _, sub := range matching {
+		sub.attach(rt)
+	}
+	go r.expire(rt, r.clock.NewTimer(routeIdleTimeout))
+	return rt
+}
+
+// Remove the route if it is no longer in use, returning true if its topic
+// should be closed.
+//
+// Must be called with the lock held.
+func (r *Router[T]) collect(rt *route[T]) bool {
+	if rt.subscriptions > 0 || rt.publishers > 0 || r.routes[rt.name] != rt {
+		return false
+	}
+	delete(r.routes, rt.name)
+	return true
+}
+
+// Close the route once it has been idle for routeIdleTimeout, so that
+// long-lived wildcard subscriptions do not keep a topic open for every name
+// ever published to.
+func (r *Router[T]) expire(rt *route[T], timer Timer) {
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C():
+		case <-rt.topic.Wait():
+			return
+		}
+		r.lock.Lock()
+		if r.routes[rt.name] != rt {
+			r.lock.Unlock()
+			return
+		}
+		wait := routeIdleTimeout - r.clock.Now().Sub(rt.lastUsed)
+		if rt.publishers > 0 || rt.topic.queueDepth() > 0 {
+			wait = routeIdleTimeout
+		}
+		if wait > 0 {
+			r.lock.Unlock()
+			timer.Reset(wait)
+			continue
+		}
+		delete(r.routes, rt.name)
+		r.lock.Unlock()
+		r.retire(rt)
+		return
+	}
+}
+
+// Shut down the topic of a route that has been removed, then detach it from
+// its subscriptions.
+func (r *Router[T]) retire(rt *route[T]) {
+	// Subscriptions stay attached until the topic has shut down, so that
+	// closing a subscription waits for any message still being delivered.
+	_ = rt.topic.Shutdown(context.Background())
+	r.lock.Lock()
+	unsubscribe := []func(){}
+	for sub := range r.subscriptions {
+		if fn, ok := sub.unsubscribe[rt]; ok {
+			delete(sub.unsubscribe, rt)
+			unsubscribe = append(unsubscribe, fn)
+		}
+	}
+	r.lock.Unlock()
+	for _, fn := range unsubscribe {
+		fn()
+	}
+}
+
+// Subscribe to all topics matching pattern.
+//
+// If "c" is nil a new channel of the default subscriber buffer size will be
+// created. The channel will be closed when the subscription or the Router is
+// closed.
+func (r *Router[T]) Subscribe(pattern string, c chan Routed[T]) (*RouterSubscription[T], error) {
+	if err := validateTopicName(pattern, true); err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = make(chan Routed[T], newOptions(r.options).subscriberBuffer)
+	}
+	sub := &RouterSubscription[T]{
+		router:      r,
+		pattern:     pattern,
+		subscriber:  getSubscriber(),
+		c:           c,
+		unsubscribe: map[*route[T]]func(){},
+	}
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil, ErrClosed
+	}
+	r.subscriptions[sub] = struct{}{}
+	// Existing topics are subscribed to without the lock held, as a topic may
+	// be blocked delivering to another subscription whose consumer is waiting
+	// for the lock. The routes are counted as subscribed so they are not
+	// collected in the meantime.
+	routes := []*route[T]{}
+	for name, rt := range r.routes {
+		if matchTopicName(pattern, name) {
+			rt.subscriptions++
+			routes = append(routes, rt)
+		}
+	}
+	sub.attaching.Add(1)
+	r.lock.Unlock()
+	defer sub.attaching.Done()
+
+	for _, rt := range routes {
+		unsubscribe := sub.handle(rt)
+		r.lock.Lock()
+		if !sub.closed && r.routes[rt.name] == rt {
+			sub.unsubscribe[rt] = unsubscribe
+			r.lock.Unlock()
+			continue
+		}
+		// The subscription was closed or the route expired meanwhile.
+		rt.subscriptions--
+		collect := r.collect(rt)
+		r.lock.Unlock()
+		unsubscribe()
+		if collect {
+			_ = rt.topic.Close()
+		}
+	}
+	return sub, nil
+}
+
+// Topics returns the names of the topics currently managed by the Router.
+func (r *Router[T]) Topics() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	names := make([]string, 0, len(r.routes))
+	for name := range r.routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close the Router, closing all subscriptions and topics.
+func (r *Router[T]) Close() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	r.closed = true
+	subscriptions := make([]*RouterSubscription[T], 0, len(r.subscriptions))
+	for sub := range r.subscriptions {
+		subscriptions = append(subscriptions, sub)
+	}
+	r.lock.Unlock()
+	for _, sub := range subscriptions {
+		_ = sub.Close()
+	}
+	// Topics with in-flight publishes are closed by their publishers.
+	return nil
+}
+
+// RouterSubscription is a subscription to all topics of a Router matching a
+// pattern.
+type RouterSubscription[T any] struct {
+	router     *Router[T]
+	pattern    string
+	subscriber string
+	c          chan Routed[T]
+	// Guarded by the Router lock.
+	unsubscribe map[*route[T]]func()
+	closed      bool
+	// Held while Subscribe attaches to existing topics.
+	attaching sync.WaitGroup
+}
+
+// C returns the channel messages are delivered on.
+func (s *RouterSubscription[T]) C() <-chan Routed[T] { return s.c }
+
+// Close the subscription.
+//
+// It is safe to call Close more than once.
+func (s *RouterSubscription[T]) Close() error {
+	r := s.router
+	r.lock.Lock()
+	if s.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	delete(r.subscriptions, s)
+	unsubscribe := s.unsubscribe
+	s.unsubscribe = nil
+	collect := []*Topic[T]{}
+	for rt := range unsubscribe {
+		rt.subscriptions--
+		if r.collect(rt) {
+			collect = append(collect, rt.topic)
+		}
+	}
+	r.lock.Unlock()
+
+	for _, unsubscribe := range unsubscribe {
+		unsubscribe()
+	}
+	for _, topic := range collect {
+		_ = topic.Close()
+	}
+	// Wait for Subscribe to detach from any topics it attached to after we
+	// unsubscribed.
+	s.attaching.Wait()
+	close(s.c)
+	return nil
+}
+
+// Attach the subscription to a new route.
+//
+// Must be called with the Router lock held. This does not block as the
+// route's topic is not yet delivering messages.
+func (s *RouterSubscription[T]) attach(rt *route[T]) {
+	rt.subscriptions++
+	s.unsubscribe[rt] = s.handle(rt)
+}
+
+// Forward messages from the route's topic to the subscription, returning a
+// function that unsubscribes.
+func (s *RouterSubscription[T]) handle(rt *route[T]) (unsubscribe func()) {
+	return rt.topic.handle(func(ctx context.Context, msg T) error {
+		select {
+		case s.c <- Routed[T]{Topic: rt.name, Msg: msg}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, nil, s.subscriber)
+}
+
+func validateTopicName(name string, pattern bool) error {
+	tokens := strings.Split(name, ".")
+	for i, token := range tokens {
+		switch {
+		case token == "":
+			return fmt.Errorf("%w %q: empty token", ErrInvalidTopicName, name)
+		case token == "*" || token == ">":
+			if !pattern {
+				return fmt.Errorf("%w %q: wildcards are only valid in subscriptions", ErrInvalidTopicName, name)
+			}
+			if token == ">" && i != len(tokens)-1 {
+				return fmt.Errorf("%w %q: \">\" must be the last token", ErrInvalidTopicName, name)
+			}
+		case strings.ContainsAny(token, "*>"):
+			return fmt.Errorf("%w %q: wildcards must be a whole token", ErrInvalidTopicName, name)
+		}
+	}
+	return nil
+}
+
+func matchTopicName(pattern, name string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	nameTokens := strings.Split(name, ".")
+	for i, token := range patternTokens {
+		switch {
+		case token == ">":
+			return len(nameTokens) > i
+		case i >= len(nameTokens):
+			return false
+		case token != "*" && token != nameTokens[i]:
+			return false
+		}
+	}
+	return len(patternTokens) == len(nameTokens)
+}
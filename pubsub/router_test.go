@@ -0,0 +1,157 @@
+package pubsub_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	. "github.com/alecthomas/types/pubsub" //nolint
+	"github.com/alecthomas/types/pubsub/pubsubtest"
+)
+
+func TestRouter(t *testing.T) {
+	router := NewRouter[string]()
+	defer router.Close() //nolint
+	ctx := context.Background()
+
+	created, err := router.Subscribe("orders.*.created", nil)
+	assert.NoError(t, err)
+	all, err := router.Subscribe("orders.>", make(chan Routed[string], 16))
+	assert.NoError(t, err)
+
+	assert.NoError(t, router.PublishSync(ctx, "orders.eu.created", "a"))
+	assert.NoError(t, router.PublishSync(ctx, "orders.eu.deleted", "b"))
+	assert.NoError(t, router.PublishSync(ctx, "orders.us.created", "c"))
+	assert.NoError(t, router.PublishSync(ctx, "orders", "ignored"))
+	assert.NoError(t, router.PublishSync(ctx, "users.eu.created", "ignored"))
+	assert.Equal(t, []string{"orders.eu.created", "orders.eu.deleted", "orders.us.created"}, router.Topics())
+
+	assert.Equal(t, []Routed[string]{
+		{Topic: "orders.eu.created", Msg: "a"},
+		{Topic: "orders.us.created", Msg: "c"},
+	}, drainRouted(created))
+	assert.Equal(t, []Routed[string]{
+		{Topic: "orders.eu.created", Msg: "a"},
+		{Topic: "orders.eu.deleted", Msg: "b"},
+		{Topic: "orders.us.created", Msg: "c"},
+	}, drainRouted(all))
+
+	// Topics are garbage collected once they have no subscribers.
+	assert.NoError(t, all.Close())
+	assert.NoError(t, all.Close())
+	assert.Equal(t, []string{"orders.eu.created", "orders.us.created"}, router.Topics())
+	assert.NoError(t, created.Close())
+	assert.Equal(t, []string{}, router.Topics())
+}
+
+func TestRouterSubscribeExistingTopic(t *testing.T) {
+	router := NewRouter[int]()
+	defer router.Close() //nolint
+	ctx := context.Background()
+	first, err := router.Subscribe("a.b", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, router.PublishSync(ctx, "a.b", 1))
+	second, err := router.Subscribe("a.*", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, router.PublishSync(ctx, "a.b", 2))
+	assert.Equal(t, []Routed[int]{{"a.b", 1}, {"a.b", 2}}, drainRouted(first))
+	assert.Equal(t, []Routed[int]{{"a.b", 2}}, drainRouted(second))
+}
+
+func TestRouterInvalidNames(t *testing.T) {
+	router := NewRouter[int]()
+	defer router.Close() //nolint
+	for _, name := range []string{"", "a..b", "a.*", "a.>", "a.b*"} {
+		assert.IsError(t, router.Publish(name, 1), ErrInvalidTopicName, name)
+	}
+	for _, pattern := range []string{"", "a.>.b", "a.b>", ".a"} {
+		_, err := router.Subscribe(pattern, nil)
+		assert.IsError(t, err, ErrInvalidTopicName, pattern)
+	}
+}
+
+func TestRouterClose(t *testing.T) {
+	router := NewRouter[int]()
+	sub, err := router.Subscribe(">", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, router.Close())
+	select {
+	case _, ok := <-sub.C():
+		assert.False(t, ok, "channel should be closed")
+	case <-time.After(time.Second):
+		t.Fatal("channel should have been closed")
+	}
+	assert.IsError(t, router.Publish("a", 1), ErrClosed)
+	_, err = router.Subscribe(">", nil)
+	assert.IsError(t, err, ErrClosed)
+}
+
+func TestRouterIdleTopics(t *testing.T) {
+	clock := pubsubtest.NewClock(time.Now())
+	router := NewRouter[int](WithClock(clock))
+	defer router.Close() //nolint
+	ctx := context.Background()
+	sub, err := router.Subscribe("orders.>", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, router.PublishSync(ctx, "orders.1", 1))
+	assert.NoError(t, router.PublishSync(ctx, "orders.2", 2))
+	assert.Equal(t, []string{"orders.1", "orders.2"}, router.Topics())
+
+	// Topics are garbage collected once idle, even with subscribers.
+	clock.BlockUntilTimer(time.Minute)
+	clock.Advance(time.Minute)
+	deadline := time.Now().Add(time.Second)
+	for len(router.Topics()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, []string{}, router.Topics())
+
+	assert.NoError(t, router.PublishSync(ctx, "orders.1", 3))
+	assert.Equal(t, []string{"orders.1"}, router.Topics())
+	assert.Equal(t, []Routed[int]{{"orders.1", 1}, {"orders.2", 2}, {"orders.1", 3}}, drainRouted(sub))
+}
+
+func TestRouterSubscribeBusyTopic(t *testing.T) {
+	router := NewRouter[int](WithAckTimeout(time.Second * 3))
+	defer router.Close() //nolint
+	busy, err := router.Subscribe("a.>", make(chan Routed[int]))
+	assert.NoError(t, err)
+	gate := make(chan struct{})
+	go func() {
+		for range busy.C() {
+			<-gate
+			// Republishing needs the Router lock.
+			_ = router.Publish("other", 0)
+		}
+	}()
+	assert.NoError(t, router.Publish("a.1", 1))
+	assert.NoError(t, router.Publish("a.1", 2))
+	// Wait for the topic to block delivering the second message.
+	time.Sleep(time.Millisecond * 50)
+	subscribed := make(chan error, 1)
+	go func() {
+		_, err := router.Subscribe("a.*", nil)
+		subscribed <- err
+	}()
+	time.Sleep(time.Millisecond * 50)
+	close(gate)
+	select {
+	case err := <-subscribed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe blocked on a busy topic")
+	}
+}
+
+func drainRouted[T any](sub *RouterSubscription[T]) []Routed[T] {
+	out := []Routed[T]{}
+	for {
+		select {
+		case msg := <-sub.C():
+			out = append(out, msg)
+		default:
+			return out
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package sse serves a pubsub.Topic or eventsource.EventSource to HTTP clients
+// as a stream of Server-Sent Events.
+//
+// Each message is sent as a single event with its JSON encoding as the data
+// and its message ID as the event ID, so that browsers reconnecting with the
+// Last-Event-ID header resume where they left off if the topic retains
+// history. IDs containing a line break or NUL cannot be represented in the
+// stream, so those messages are sent without an event ID.
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/types/eventsource"
+	"github.com/alecthomas/types/pubsub"
+)
+
+// Option configures a Handler.
+type Option func(*options)
+
+type options struct {
+	heartbeat time.Duration
+	buffer    int
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		heartbeat: time.Second * 15,
+		buffer:    256,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithHeartbeat sets the interval at which a comment is sent to idle clients
+// to keep the connection open through proxies.
+//
+// Defaults to 15 seconds. Zero disables heartbeats.
+func WithHeartbeat(interval time.Duration) Option {
+	return func(o *options) { o.heartbeat = interval }
+}
+
+// WithBuffer sets the number of messages buffered for each client.
+//
+// A client that falls further behind than this is disconnected rather than
+// blocking the topic, and can resume with Last-Event-ID.
+//
+// Defaults to 256.
+func WithBuffer(size int) Option {
+	return func(o *options) { o.buffer = size }
+}
+
+// Handler returns an http.Handler that streams messages published to topic as
+// Server-Sent Events.
+//
+// If the request has a Last-Event-ID header, only history published after
+// that message is replayed. See pubsub.WithHistory and pubsub.ReplayAfter.
+//
+// Clients are unsubscribed when they disconnect, and disconnected when the
+// topic is closed.
+func Handler[T any](topic *pubsub.Topic[T], options ...Option) http.Handler {
+	opts := newOptions(options)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscribeOptions := []pubsub.SubscribeOption{}
+		if id := r.Header.Get("Last-Event-ID"); id != "" {
+			subscribeOptions = append(subscribeOptions, pubsub.ReplayAfter(id))
+		}
+		serve(w, r, topic, opts, subscribeOptions, nil)
+	})
+}
+
+// EventSourceHandler returns an http.Handler that streams the current value of
+// source, followed by every change, as Server-Sent Events.
+//
+// As the current value is always sent, Last-Event-ID is ignored.
+func EventSourceHandler[T any](source *eventsource.EventSource[T], options ...Option) http.Handler {
+	opts := newOptions(options)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, source.Topic, opts, nil, source.Load)
+	})
+}
+
+// Stream events to the client. If current is non-nil, its value is sent
+// before any messages.
+func serve[T any](w http.ResponseWriter, r *http.Request, topic *pubsub.Topic[T], opts options, subscribeOptions []pubsub.SubscribeOption, current func() T) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	// Subscribe before loading the current value so that no change is
+	// missed.
+	ch, err := topic.SubscribeSyncContext(ctx, nil, subscribeOptions...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer topic.UnsubscribeSyncContext(context.Background(), ch) //nolint:errcheck
+
+	// Ack messages as they arrive so that a slow client does not block the
+	// topic, buffering them for the client.
+	queue := make(chan pubsub.Message[T], opts.buffer)
+	go func() {
+		defer close(queue)
+		for msg := range ch {
+			msg.Ack()
+			select {
+			case queue <- msg:
+			default:
+				// The client is too far behind.
+				cancel()
+			}
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if current != nil {
+		if err := writeEvent(w, "", current()); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	var heartbeat <-chan time.Time
+	if opts.heartbeat > 0 {
+		ticker := time.NewTicker(opts.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	for {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				// The topic was closed.
+				return
+			}
+			if err := writeEvent(w, msg.ID, msg.Msg); err != nil {
+				return
+			}
+
+		case <-heartbeat:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+
+		case <-ctx.Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent[T any](w io.Writer, id string, msg T) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	// A line break would let the ID inject fields into the stream, and clients
+	// ignore IDs containing NUL.
+	if id != "" && !strings.ContainsAny(id, "\r\n\x00") {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,126 @@
+package sse_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/alecthomas/types/eventsource"
+	"github.com/alecthomas/types/pubsub"
+	"github.com/alecthomas/types/pubsub/sse"
+)
+
+type event struct {
+	Count int `json:"count"`
+}
+
+// Connect to url, returning a function that reads the next event as lines.
+func connect(t *testing.T, url string, lastEventID string) func() []string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	scanner := bufio.NewScanner(resp.Body)
+	return func() []string {
+		t.Helper()
+		lines := []string{}
+		for scanner.Scan() {
+			if scanner.Text() == "" {
+				return lines
+			}
+			lines = append(lines, scanner.Text())
+		}
+		return nil
+	}
+}
+
+func TestHandler(t *testing.T) {
+	topic := pubsub.New[event](pubsub.WithHistory(10))
+	defer topic.Close() //nolint
+	server := httptest.NewServer(sse.Handler(topic))
+	t.Cleanup(server.Close)
+
+	next := connect(t, server.URL, "")
+	assert.NoError(t, topic.PublishSync(event{1}, pubsub.WithMessageID("1")))
+	assert.NoError(t, topic.PublishSync(event{2}, pubsub.WithMessageID("2")))
+	assert.Equal(t, []string{"id: 1", `data: {"count":1}`}, next())
+	assert.Equal(t, []string{"id: 2", `data: {"count":2}`}, next())
+
+	// Resume after the first event.
+	next = connect(t, server.URL, "1")
+	assert.Equal(t, []string{"id: 2", `data: {"count":2}`}, next())
+
+	// The stream ends when the topic is closed.
+	assert.NoError(t, topic.Close())
+	assert.Equal(t, nil, next())
+}
+
+func TestHandlerUnsafeID(t *testing.T) {
+	topic := pubsub.New[event]()
+	defer topic.Close() //nolint
+	server := httptest.NewServer(sse.Handler(topic))
+	t.Cleanup(server.Close)
+
+	next := connect(t, server.URL, "")
+	assert.NoError(t, topic.PublishSync(event{1}, pubsub.WithMessageID("1\nevent: evil")))
+	assert.NoError(t, topic.PublishSync(event{2}, pubsub.WithMessageID("2\r\ndata: evil")))
+	assert.Equal(t, []string{`data: {"count":1}`}, next())
+	assert.Equal(t, []string{`data: {"count":2}`}, next())
+}
+
+func TestHandlerHeartbeat(t *testing.T) {
+	topic := pubsub.New[event]()
+	defer topic.Close() //nolint
+	server := httptest.NewServer(sse.Handler(topic, sse.WithHeartbeat(time.Millisecond*10)))
+	t.Cleanup(server.Close)
+
+	next := connect(t, server.URL, "")
+	assert.Equal(t, []string{": heartbeat"}, next())
+}
+
+func TestHandlerUnsubscribesOnDisconnect(t *testing.T) {
+	topic := pubsub.New[event]()
+	defer topic.Close() //nolint
+	server := httptest.NewServer(sse.Handler(topic))
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(topic.Stats().Subscribers))
+	_ = resp.Body.Close()
+	deadline := time.Now().Add(time.Second * 5)
+	for len(topic.Stats().Subscribers) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber was not removed")
+		}
+		// Publish so the handler notices the disconnect when writing.
+		topic.Publish(event{})
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestEventSourceHandler(t *testing.T) {
+	source := eventsource.New[event]()
+	defer source.Close() //nolint
+	assert.NoError(t, source.Store(event{1}))
+	server := httptest.NewServer(sse.EventSourceHandler(source))
+	t.Cleanup(server.Close)
+
+	next := connect(t, server.URL, "")
+	assert.Equal(t, []string{`data: {"count":1}`}, next())
+	assert.NoError(t, source.Store(event{2}))
+	lines := next()
+	assert.Equal(t, `data: {"count":2}`, lines[len(lines)-1])
+	assert.True(t, strings.HasPrefix(lines[0], "id: "))
+}
@@ -0,0 +1,158 @@
+package pubsub
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// The upper bounds of the ack latency histogram buckets.
+var ackLatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// TopicStats is a snapshot of the state of a Topic.
+type TopicStats struct {
+	// QueueDepth is the number of published messages waiting to be delivered.
+	QueueDepth int
+	// Subscribers are the current subscribers, ordered by identity.
+	Subscribers []SubscriberStats
+}
+
+// SubscriberStats is a snapshot of the statistics for a single subscriber.
+type SubscriberStats struct {
+	// Subscriber is the "file:line: function" of the code that subscribed.
+	Subscriber string
+	// Group is the consumer group of the subscriber, if any.
+	Group string
+	// Delivered is the number of messages delivered to the subscriber,
+	// including redeliveries.
+	Delivered uint64
+	Acked     uint64
+	Nacked    uint64
+	// TimedOut is the number of messages not accepted or acked within the ack
+	// timeout.
+	TimedOut uint64
+	// DeadLettersDropped is the number of dead letters discarded because the
+	// dead letter topic was closed or full.
+	DeadLettersDropped uint64
+	// AckLatency is the time between delivery and ack or nack.
+	AckLatency Histogram
+}
+
+// Histogram is a snapshot of a distribution of durations.
+type Histogram struct {
+	// Bounds are the inclusive upper bounds of each bucket.
+	Bounds []time.Duration
+	// Counts has one more entry than Bounds, the last being the count of
+	// observations greater than every bound.
+	Counts []uint64
+	// Count is the total number of observations.
+	Count uint64
+	// Sum is the sum of all observations.
+	Sum time.Duration
+}
+
+// Stats returns a snapshot of the topic and its subscribers.
+func (s *Topic[T]) Stats() TopicStats {
+	s.lock.RLock()
+	subscribers := make([]SubscriberStats, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subscribers = append(subscribers, sub.stats.snapshot())
+	}
+	s.lock.RUnlock()
+	sort.SliceStable(subscribers, func(i, j int) bool {
+		return subscribers[i].Subscriber < subscribers[j].Subscriber
+	})
+	return TopicStats{
+		QueueDepth:  s.queueDepth(),
+		Subscribers: subscribers,
+	}
+}
+
+type subscriberStats struct {
+	subscriber string
+	group      string
+	delivered  atomic.Uint64
+	acked      atomic.Uint64
+	nacked     atomic.Uint64
+	timedOut   atomic.Uint64
+	latency    histogram
+	// Dead letters discarded because the dead letter topic was closed or full.
+	deadLettersDropped atomic.Uint64
+	// Total time spent handling messages, in nanoseconds, for
+	// BalanceLeastLoaded.
+	busy atomic.Int64
+}
+
+func newSubscriberStats(subscriber, group string) *subscriberStats {
+	return &subscriberStats{
+		subscriber: subscriber,
+		group:      group,
+		latency:    histogram{counts: make([]atomic.Uint64, len(ackLatencyBuckets)+1)},
+	}
+}
+
+func (s *subscriberStats) observeAck(latency time.Duration, err error) {
+	if err == nil {
+		s.acked.Add(1)
+	} else {
+		s.nacked.Add(1)
+	}
+	s.latency.observe(latency)
+	s.busy.Add(int64(latency))
+}
+
+func (s *subscriberStats) observeTimeout(timeout time.Duration) {
+	s.timedOut.Add(1)
+	s.busy.Add(int64(timeout))
+}
+
+func (s *subscriberStats) snapshot() SubscriberStats {
+	return SubscriberStats{
+		Subscriber:         s.subscriber,
+		Group:              s.group,
+		Delivered:          s.delivered.Load(),
+		Acked:              s.acked.Load(),
+		Nacked:             s.nacked.Load(),
+		TimedOut:           s.timedOut.Load(),
+		DeadLettersDropped: s.deadLettersDropped.Load(),
+		AckLatency:         s.latency.snapshot(),
+	}
+}
+
+type histogram struct {
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	bucket := sort.Search(len(ackLatencyBuckets), func(i int) bool { return d <= ackLatencyBuckets[i] })
+	h.counts[bucket].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	counts := make([]uint64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = h.counts[i].Load()
+	}
+	return Histogram{
+		Bounds: append([]time.Duration(nil), ackLatencyBuckets...),
+		Counts: counts,
+		Count:  h.count.Load(),
+		Sum:    time.Duration(h.sum.Load()),
+	}
+}
@@ -0,0 +1,62 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Subscription is a handle to an asynchronous subscription to a Topic.
+type Subscription[T any] struct {
+	topic *Topic[T]
+	c     chan T
+	fwd   *forwarder[T]
+	once  sync.Once
+}
+
+// SubscriptionStats is a snapshot of the statistics for a Subscription.
+type SubscriptionStats struct {
+	// Delivered is the number of messages sent to the subscription channel.
+	Delivered uint64
+	// Dropped is the number of messages discarded by the overflow policy.
+	Dropped uint64
+}
+
+// C returns the channel messages are delivered on.
+//
+// The channel will be closed when the subscription or the topic is closed.
+func (s *Subscription[T]) C() <-chan T { return s.c }
+
+// Stats returns a snapshot of the subscription statistics.
+func (s *Subscription[T]) Stats() SubscriptionStats {
+	return SubscriptionStats{
+		Delivered: s.fwd.delivered.Load(),
+		Dropped:   s.fwd.dropped.Load(),
+	}
+}
+
+// Close unsubscribes from the topic, discarding any undelivered messages.
+//
+// It is safe to call Close more than once, or after the topic is closed.
+func (s *Subscription[T]) Close() error {
+	_ = s.close(context.Background())
+	return nil
+}
+
+func (s *Subscription[T]) close(ctx context.Context) (err error) {
+	s.once.Do(func() {
+		s.topic.rawChannelMap.Delete(s.c)
+		// Drain the subscription channel
+		go func() {
+			for range s.c {
+			}
+		}()
+		msg := unsubscribe[T](s.fwd.forward)
+		err = s.topic.sendControl(ctx, msg)
+		if err != nil && !errors.Is(err, ErrClosed) {
+			// Still unsubscribe so the subscription does not leak.
+			go s.topic.sendControl(context.Background(), msg) //nolint:errcheck
+		}
+	})
+	return err
+}